@@ -0,0 +1,147 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+chan.go
+This file implements a channel, whose blocking operations are recorded as
+resource dependencies. A send waits for a receive and makes a receive
+possible, a receive waits for a send and makes a send possible. This way the
+detector finds cycles of locks and channels, e.g. a routine which sends on an
+unbuffered channel while holding a lock the receiver needs.
+*/
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// element of the channel, containing the vector clock of the sender
+type chanItem[T any] struct {
+	// sent value
+	v T
+	// vector clock of the sending routine
+	vc vectorClock
+}
+
+// Type to implement a channel
+// Send, Recv and Close correspond to the channel operations ch <- v, <-ch and
+// close(ch).
+type Chan[T any] struct {
+	// channel for the actual communication
+	ch chan chanItem[T]
+	// resource of the sends, released by senders and waited for by receivers
+	sendRes *resource
+	// resource of the receives, released by receivers and waited for by senders
+	recvRes *resource
+}
+
+// create and return a new channel
+//  Args:
+//   size (int): buffer size of the channel, 0 for an unbuffered channel
+//  Returns:
+//   (*Chan[T]): the created channel
+func NewChan[T any](size int) *Chan[T] {
+	// initialize detector if necessary
+	initialize()
+	atomic.StoreUint32(&acquiredLocksUsed, 1)
+
+	_, file, line, _ := runtime.Caller(1)
+	return &Chan[T]{
+		ch:      make(chan chanItem[T], size),
+		sendRes: newResource("chan send", file, line),
+		recvRes: newResource("chan receive", file, line),
+	}
+}
+
+// Send sends v on the channel. If the channel is unbuffered or its buffer is
+// full, the send waits for a receive while holding the locks of the routine.
+//  Args:
+//   v (T): value to send
+//  Returns:
+//   nil
+func (c *Chan[T]) Send(v T) {
+	// the send can only block if the buffer is full
+	if len(c.ch) == cap(c.ch) {
+		waitResource(c.recvRes)
+	}
+
+	// the send makes a receive possible
+	releaseAcquiredResource(c.sendRes)
+
+	var vc vectorClock
+	if r := getResourceRoutine(); r != nil {
+		vc = r.sendClock()
+	}
+
+	c.ch <- chanItem[T]{v: v, vc: vc}
+}
+
+// Recv receives a value from the channel. If the channel is empty, the receive
+// waits for a send while holding the locks of the routine.
+//  Returns:
+//   (T): the received value, the zero value if the channel is closed
+//   (bool): false if the channel is closed and empty, true otherwise
+func (c *Chan[T]) Recv() (T, bool) {
+	// the receive can only block if the buffer is empty
+	if len(c.ch) == 0 {
+		waitResource(c.sendRes)
+	}
+
+	// the receive makes a send possible
+	releaseAcquiredResource(c.recvRes)
+
+	item, ok := <-c.ch
+
+	// everything the sender did before the send happens before the receive
+	if ok {
+		if r := getResourceRoutine(); r != nil {
+			r.receiveClock(item.vc)
+		}
+	}
+
+	return item.v, ok
+}
+
+// Close closes the channel. Closing makes all receives possible.
+//  Returns:
+//   nil
+func (c *Chan[T]) Close() {
+	releaseAcquiredResource(c.sendRes)
+	close(c.ch)
+}
+
+// Len returns the number of elements in the buffer of the channel.
+//  Returns:
+//   (int): number of buffered elements
+func (c *Chan[T]) Len() int {
+	return len(c.ch)
+}
+
+// Cap returns the buffer size of the channel.
+//  Returns:
+//   (int): buffer size
+func (c *Chan[T]) Cap() int {
+	return cap(c.ch)
+}
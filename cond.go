@@ -0,0 +1,212 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+cond.go
+This file implements the drop-in-replacement for sync.Cond. Waiting for the
+condition variable and signaling it are recorded as resource dependencies,
+so that the detector can find waits, which can never be signaled, because
+the signaling routine needs a lock held by the waiting routine. A routine
+blocked in Wait waits for the routines, which signaled the condition variable
+before. If all of them are blocked, the periodical detection can confirm the
+deadlock.
+*/
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Type to implement a condition variable
+// It can be used as a drop in replacement for sync.Cond. L is held while
+// observing or changing the condition. To be considered by the detector, L
+// must be a Mutex, a RWMutex or the Locker returned by RLocker of a RWMutex.
+type Cond struct {
+	// L is held while observing or changing the condition
+	L sync.Locker
+	// resource which represents the condition variable in the lock trees
+	res *resource
+	// set to 1 after the condition variable was initialized
+	in uint32
+	// lock to prevent multiple concurrent initializations
+	inLock sync.Mutex
+	// lock to prevent concurrent access to waiters
+	waitersLock sync.Mutex
+	// channels of the waiting routines in the order of their wait calls
+	waiters []chan struct{}
+}
+
+// create and return a new condition variable, which can be used as a
+// drop-in replacement for sync.Cond
+//  Args:
+//   l (sync.Locker): lock of the condition variable
+//  Returns:
+//   (*Cond): the created condition variable
+func NewCond(l sync.Locker) *Cond {
+	c := &Cond{L: l}
+	c.init()
+	return c
+}
+
+// init initializes the condition variable if it has not been initialized yet.
+// The position of the caller of the function that called init is saved as
+// the creation of the condition variable.
+//  Returns:
+//   nil
+func (c *Cond) init() {
+	// fast path if the condition variable is already initialized
+	if atomic.LoadUint32(&c.in) == 1 {
+		return
+	}
+
+	c.inLock.Lock()
+	defer c.inLock.Unlock()
+
+	// another routine may have initialized the condition variable in the meantime
+	if c.in == 1 {
+		return
+	}
+
+	// initialize detector if necessary
+	initialize()
+
+	// save the position of the NewCond or first call
+	_, file, line, _ := runtime.Caller(2)
+	c.res = newResource("cond", file, line)
+
+	atomic.StoreUint32(&c.in, 1)
+}
+
+// Wait atomically unlocks c.L and suspends the execution of the calling
+// routine. After being woken up by Signal or Broadcast, Wait locks c.L before
+// returning. While the routine is suspended, the periodical detection
+// considers it as waiting for the routines which signaled c before.
+//  Returns:
+//   nil
+func (c *Cond) Wait() {
+	c.init()
+
+	// register the routine as waiter before unlocking L to not miss a signal
+	ch := make(chan struct{})
+	c.waitersLock.Lock()
+	c.waiters = append(c.waiters, ch)
+	c.waitersLock.Unlock()
+
+	// L is released and acquired without the functions of the locker, so
+	// that the caller of Wait is recorded as position of the unlock and lock
+	m := lockerToMutexInt(c.L)
+	_, rLock := c.L.(*rlocker)
+	if m == nil {
+		c.L.Unlock()
+	} else {
+		if opts.activated {
+			unlockInt(m, rLock)
+		}
+		release(m, rLock)
+	}
+
+	// the routine waits for the signal while holding its remaining locks
+	waitResource(c.res)
+
+	r := getResourceRoutine()
+	if r != nil {
+		r.startWaiting(c.res, false, false)
+	}
+
+	<-ch
+
+	if r != nil {
+		r.stopWaiting()
+	}
+
+	if m == nil {
+		c.L.Lock()
+	} else {
+		lockInt(m, rLock)
+	}
+}
+
+// Signal wakes one routine waiting on c, if there is any.
+//  Returns:
+//   nil
+func (c *Cond) Signal() {
+	c.init()
+
+	// the signal depends on all locks held by the routine
+	signalResource(c.res, lockerToMutexInt(c.L))
+	c.addSignaler()
+
+	c.waitersLock.Lock()
+	if len(c.waiters) != 0 {
+		close(c.waiters[0])
+		c.waiters = c.waiters[1:]
+	}
+	c.waitersLock.Unlock()
+}
+
+// Broadcast wakes all routines waiting on c.
+//  Returns:
+//   nil
+func (c *Cond) Broadcast() {
+	c.init()
+
+	// the signal depends on all locks held by the routine
+	signalResource(c.res, lockerToMutexInt(c.L))
+	c.addSignaler()
+
+	c.waitersLock.Lock()
+	for _, ch := range c.waiters {
+		close(ch)
+	}
+	c.waiters = nil
+	c.waitersLock.Unlock()
+}
+
+// remember the calling routine as signaler of c for the periodical detection
+//  Returns:
+//   nil
+func (c *Cond) addSignaler() {
+	if r := getResourceRoutine(); r != nil {
+		c.res.addSignaler(r.id)
+	}
+}
+
+// get the lock of the detector, which is used as the locker l
+//  Args:
+//   l (sync.Locker): locker
+//  Returns:
+//   (mutexInt): the lock, nil if l is not a lock of the detector
+func lockerToMutexInt(l sync.Locker) mutexInt {
+	switch m := l.(type) {
+	case *Mutex:
+		return m
+	case *RWMutex:
+		return m
+	case *rlocker:
+		return (*RWMutex)(m)
+	}
+	return nil
+}
@@ -37,49 +37,41 @@ acquired.
 // i.e. all lock which were already locked by the same routine, when
 // l was acquired.
 type dependency struct {
-	mu           mutexInt   // lock
-	holdingSet   []mutexInt // locks which where locked while mu was acquired
-	holdingCount int        // on how many locks does mu depend
+	mu           mutexInt    // lock
+	rLock        bool        // true if mu was acquired as reader lock
+	holdingSet   []mutexInt  // locks which where locked while mu was acquired
+	holdingRLock []bool      // true for the locks in holdingSet which were held as reader lock
+	holdingCount int         // on how many locks does mu depend
+	caller       callerInfo  // info about the acquisition of mu, which created the dependency
+	id           int64       // internal id of the routine which created the dependency
+	firstVC      vectorClock // vector clock of the routine at the first occurrence of the dependency
+	lastVC       vectorClock // vector clock of the routine at the last occurrence of the dependency
 }
 
 // newDependency creates and returns a new dependency object
 //  Args:
 //   mu (mutexInt): lock of the dependency
+//   rLock (bool): true if mu was acquired as reader lock
 //   currentLocks ([]mutexInt): list of locks mu depends on
+//   currentRLocks ([]bool): true for the locks in currentLocks which are held
+//    as reader lock
 //   numberOfLocks (int): number of locks lock depends on
 //  Returns:
 //   (dependency) : the created dependency
-func newDependency(lock mutexInt, currentLocks []mutexInt,
-	numberOfLocks int) dependency {
+func newDependency(lock mutexInt, rLock bool, currentLocks []mutexInt,
+	currentRLocks []bool, numberOfLocks int) dependency {
 	// create dependency
 	d := dependency{
 		mu:           lock,
+		rLock:        rLock,
 		holdingCount: numberOfLocks,
-		holdingSet:   make([]mutexInt, opts.maxNumberOfDependentLocks),
+		holdingSet:   make([]mutexInt, numberOfLocks),
+		holdingRLock: make([]bool, numberOfLocks),
 	}
 
-	// copy currentLocks into d.holding set
-	for i := 0; i < numberOfLocks; i++ {
-		d.holdingSet = append(d.holdingSet, currentLocks[i])
-	}
+	// copy currentLocks and the reader information into the holding set
+	copy(d.holdingSet, currentLocks)
+	copy(d.holdingRLock, currentRLocks)
 
 	return d
 }
-
-// update updates a dependency
-//  Args:
-//   lock (mutexInt): new lock of the dependency
-//   hs (*[]mutexInt): new holding set
-//   numberOfLocks (int): new number of locks lock depends on
-//  Returns:
-//   nil
-func (d *dependency) update(lock mutexInt, hs *[]mutexInt, numberOfLocks int) {
-	// set new lock
-	d.mu = lock
-
-	// copy hs into the holding set
-	copy(d.holdingSet, *hs)
-
-	// set new holdingCount
-	d.holdingCount = numberOfLocks
-}
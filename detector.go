@@ -37,8 +37,8 @@ It is based on iGoodLock and reports potential deadlocks in the code.
 
 import (
 	"fmt"
-	"os"
 	"runtime"
+	"sort"
 )
 
 // ================ Comprehensive Detection ================
@@ -50,36 +50,54 @@ import (
 // It has to be run at the end of a program to
 // detect potential deadlocks in the program. This can be one by calling
 // it as a defer statement at the beginning of the main function of the
-// program.
+// program. The found potential deadlocks are printed. If the output format is
+// FormatSARIF, the log with all reports is written afterwards.
 //  Returns:
 //   nil
 func FindPotentialDeadlocks() {
+	reports := GetPotentialDeadlocks()
+	if len(reports) != 0 {
+		printReports(reports)
+	}
+	FlushReports()
+}
+
+// GetPotentialDeadlocks runs the comprehensive detection like
+// FindPotentialDeadlocks, but returns the found potential deadlocks instead
+// of printing them. The reports also contain the locks which are still held
+// by the routines and the locks leaked by terminated routines.
+//  Returns:
+//   ([]Report): reports of the found potential deadlocks
+func GetPotentialDeadlocks() []Report {
 	// check if comprehensive detection is disabled, and if do abort deadlock
 	//detection
 	if !opts.comprehensiveDetection {
-		return
+		return nil
 	}
 
 	// only run detector if at least two routines were running during the
-	// execution of the program
-	if numberRoutines > 1 {
-		// abort check if the lock trees contain less than 2 unique dependencies
-		if !isNumberDependenciesGreaterEqualTwo() {
-			return
-		}
-
+	// execution of the program and the lock trees contain at least 2 unique
+	// dependencies
+	var reports []Report
+	rs := getAllRoutines()
+	if len(rs) > 1 && isNumberDependenciesGreaterEqualTwo(rs) {
 		// start the detection of potential deadlocks
-		detect()
+		reports = detect(rs)
 	}
+
+	// add the locks which are still held
+	return append(reports, getHeldLockReports()...)
 }
 
 // isNumberDependenciesGreaterEqualTwo counts the number of unique dependencies in
 // all and checks if it is greater or equal two lock trees.
 // It is not necessary to run comprehensive detection if less then
 // two unique dependencies exists.
+//  Args:
+//   rs ([]routine): routines to check
 //  Returns:
 //   (bool) : true, if number of unique dependencies is greater or equal than 2,false otherwise
-func isNumberDependenciesGreaterEqualTwo() bool {
+func isNumberDependenciesGreaterEqualTwo(rs []routine) bool {
 	// number of already found unique dependencies
 	depCount := 0
 
@@ -90,8 +108,8 @@ func isNumberDependenciesGreaterEqualTwo() bool {
 	dependencyMap := make(map[string]struct{})
 
 	// parse all routines
-	for i := 0; i < numberRoutines; i++ {
-		current := routines[i]
+	for i := 0; i < len(rs); i++ {
+		current := rs[i]
 
 		// parse routine i
 		for j := 0; j < current.depCount; j++ {
@@ -120,7 +138,8 @@ func isNumberDependenciesGreaterEqualTwo() bool {
 
 // getDependencyString calculates the dependency string for a given
 // dependency. The string is the concatenation of the on the memory positions
-// of mu of the dependency and the locks in the holdingSet of the dependency.
+// of mu of the dependency and the locks in the holdingSet of the dependency
+// together with the information whether they are reader locks.
 //  Args:
 //   str (*string): the dependency string is stored in str
 //   dep (*dependency): dependency for which the string gets calculated
@@ -128,18 +147,23 @@ func isNumberDependenciesGreaterEqualTwo() bool {
 //   nil
 func getDependencyString(str *string, dep *dependency) {
 	// add the memory position of mu of dep
-	*str = fmt.Sprint(dep.mu.getMemoryPosition())
+	*str = fmt.Sprint(lockKey(dep.mu), dep.rLock)
 
 	// add the memory position of the locks in the lockSet of dep
 	for i := 0; i < dep.holdingCount; i++ {
-		*str += fmt.Sprint(dep.holdingSet[i].getMemoryPosition())
+		*str += fmt.Sprint(",", lockKey(dep.holdingSet[i]), dep.holdingRLock[i])
 	}
 }
 
 // detect runs the detection for loops in the lock trees
+//  Args:
+//   rs ([]routine): routines with the lock trees to check
 //  Returns:
-//   nil
-func detect() {
+//   ([]Report): reports of the found potential deadlocks
+func detect(rs []routine) []Report {
+	// reports of the found cycles
+	var reports []Report
+
 	// visiting gets set to index of the routine on which the search for circles is started
 	var visiting int
 
@@ -153,11 +177,11 @@ func detect() {
 	// of the search.
 	// They can also be temporarily ignored, if a dependency of this routine
 	// is already in the path which is currently explored
-	isTraversed := make([]bool, numberRoutines)
+	isTraversed := make([]bool, len(rs))
 
 	// traverse all routines as starting routine for the loop search
-	for i := 0; i < numberRoutines; i++ {
-		routine := routines[i]
+	for i := 0; i < len(rs); i++ {
+		routine := rs[i]
 
 		visiting = i
 
@@ -172,12 +196,14 @@ func detect() {
 			stack.push(dep, i)
 
 			// start the depth-first search to find potential circular paths
-			dfs(&stack, visiting, &isTraversed)
+			dfs(rs, &stack, visiting, &isTraversed, &reports)
 
 			// remove dep from the stack
 			stack.pop()
 		}
 	}
+
+	return reports
 }
 
 // dfs runs the recursive depth-first search.
@@ -185,18 +211,21 @@ func detect() {
 // After a new dependency is added to the currently explored path, it is checked,
 // if the path forms a circle.
 //  Args:
+//   rs ([]routine): routines with the lock trees to check
 //   stack (*depStack): stack witch represent the currently explored path
 //   visiting int: index of the routine of the first element in the currently explored path
 //   isTraversed (*([]bool)): list which stores which routines have already been traversed
 //    (either as starting routine or as a routine which already has a dep in the current path)
+//   reports (*[]Report): list to which the reports of found cycles are added
 //  Returns:
 //   nil
-func dfs(stack *depStack, visiting int, isTraversed *([]bool)) {
+func dfs(rs []routine, stack *depStack, visiting int, isTraversed *([]bool),
+	reports *[]Report) {
 	// Traverse through all routines to find the potential next step in the path.
 	// Routines with index <= visiting have already been used as starting routine
 	// and therefore don't have to been considered again.
-	for i := visiting + 1; i < numberRoutines; i++ {
-		routine := routines[i]
+	for i := visiting + 1; i < len(rs); i++ {
+		routine := rs[i]
 
 		// continue if the routine has already been traversed
 		if (*isTraversed)[i] {
@@ -207,12 +236,12 @@ func dfs(stack *depStack, visiting int, isTraversed *([]bool)) {
 		for j := 0; j < routine.depCount; j++ {
 			dep := routine.dependencies[j]
 			// check if adding dep to the stack would still be a valid path
-			if isChain(stack, dep, i) {
+			if isChain(stack, dep) {
 				// check if adding dep to the stack would lead to a cycle
-				if isCycleChain(stack, dep, i) {
+				if isCycleChain(stack, dep) {
 					// report the found potential deadlock
-					stack.push(dep, j)
-					reportDeadlock(stack)
+					stack.push(dep, i)
+					*reports = append(*reports, newReportCycle(DeadlockPotential, stack))
 					stack.pop()
 				} else { // the path is not a cycle yet
 					// add dep to the current path
@@ -220,7 +249,7 @@ func dfs(stack *depStack, visiting int, isTraversed *([]bool)) {
 					(*isTraversed)[i] = true
 
 					// call dfs recursively to traverse the path further
-					dfs(stack, visiting, isTraversed)
+					dfs(rs, stack, visiting, isTraversed, reports)
 
 					// dep did not lead to a cycle in the lock trees.
 					// It is removed to explore different paths
@@ -234,6 +263,36 @@ func dfs(stack *depStack, visiting int, isTraversed *([]bool)) {
 
 // ================ Periodical Detection ================
 
+// state of the periodical detection, which is kept between the runs
+type periodicalState struct {
+	// sequence numbers of the waits of the routines in the last run
+	lastWaiting map[int]uint64
+	// sequence numbers of the waits, which are part of a reported deadlock
+	reported map[uint64]struct{}
+}
+
+// create the state of the periodical detection
+//  Returns:
+//   (*periodicalState): the created state
+func newPeriodicalState() *periodicalState {
+	return &periodicalState{
+		lastWaiting: make(map[int]uint64),
+		reported:    make(map[uint64]struct{}),
+	}
+}
+
+// wait of a routine, which is considered by the periodical detection
+type waitInfo struct {
+	// the waiting routine
+	r *routine
+	// lock the routine waits for
+	m mutexInt
+	// true if the routine waits for m as reader lock
+	rLock bool
+	// sequence number of the wait
+	seq uint64
+}
+
 // periodicalDetection is the main function to start the periodical detection.
 // It is called periodically to detect if the program is in a local deadlock
 // state i.e. a state in which only a subset of the running routines are in
@@ -243,174 +302,256 @@ func dfs(stack *depStack, visiting int, isTraversed *([]bool)) {
 //  If the program is in a total deadlock, i.e. no routine is running anymore,
 //  it is normally automatically terminated my the go-runtime deadlock detection.
 //  In this case the comprehensive detection can not be started.
-// To detect such local deadlocks, the detector uses the dependency of each
-// routine, which was last added to the routine and searches for circles in
-// this set of dependencies.
+// To detect such local deadlocks, the detector builds a wait-for graph of the
+// routines which are blocked on a lock. An edge from a waiting routine to
+// another routine means, that the other routine holds the lock the waiting
+// routine is blocked on. Only routines which have been waiting for the same
+// acquisition since the last run are considered. Acquisitions with a context
+// or timeout are not considered, because they end when the context is done. These routines can not have
+// released or acquired any lock since the last run, therefore each cycle in
+// the graph is an actual deadlock.
 //  Args:
-//   lastHolding (*[]mutexInt): list of the dependencies which were considered
-//    in the last run
+//   state (*periodicalState): state of the periodical detection
 //  Returns:
 //   nil
-func periodicalDetection(lastHolding *[]mutexInt) {
+func periodicalDetection(state *periodicalState) {
 	// only check if at least two routines are currently running
 	if runtime.NumGoroutine() < 2 {
 		return
 	}
 
-	// A stack is used to represent the currently explored path in the lock trees.
-	// A dependency is added to the path by pushing it on top of the stack.
+	// collect the routines which wait for the same acquisition as in the last run
+	waiting := make(map[int]waitInfo)
+	lastWaiting := make(map[int]uint64)
+	createRoutineLock.Lock()
+	for index := 0; index < numberRoutines; index++ {
+		r := routines[index]
+		m, rLock, seq, cancelable := r.getWaiting()
+		if m == nil {
+			continue
+		}
 
-	// the detection is only run if the number of routines which hold at least two
-	// locks is at least 2 and the situation has changed since the late periodical check
-	nrThreadsHoldingLocks := 0
-	sthNew := false
-
-	// traverse all routines
-	for index, r := range routines {
-		// check if the routine holds at least two lock and the last added dependency
-		// has changed since the last check
-		holds := r.holdingCount - 1
-		if holds >= 0 && (*lastHolding)[index] != r.holdingSet[holds] {
-			(*lastHolding)[index] = r.holdingSet[holds]
-			sthNew = true
-			if holds > 0 {
-				nrThreadsHoldingLocks++
-			}
-		} else if holds < 0 && (*lastHolding)[index] != nil {
-			(*lastHolding)[index] = nil
-			sthNew = true
+		// a routine in LockContext or LockTimeout is not blocked permanently.
+		// If it is part of a cycle, the cycle is reported as lock timeout when
+		// the acquisition is canceled
+		if cancelable {
+			continue
+		}
+		lastWaiting[index] = seq
+		if state.lastWaiting[index] == seq {
+			waiting[index] = waitInfo{r: r, m: m, rLock: rLock, seq: seq}
 		}
 	}
+	createRoutineLock.Unlock()
+	state.lastWaiting = lastWaiting
 
-	// abort the detection if nothing has changed or not enough routines hold locks
-	if !sthNew || nrThreadsHoldingLocks <= 1 {
+	// a cycle needs at least two waiting routines
+	if len(waiting) < 2 {
 		return
 	}
 
-	// run the detection
-	detectionPeriodical(lastHolding)
+	for _, cycle := range findWaitCycles(waiting, buildWaitForGraph(waiting)) {
+		// report each deadlock only once
+		isNew := false
+		for _, index := range cycle {
+			if _, ok := state.reported[waiting[index].seq]; !ok {
+				state.reported[waiting[index].seq] = struct{}{}
+				isNew = true
+			}
+		}
+		if !isNew {
+			continue
+		}
+
+		// the deadlock is reported and the detector reacts as set in the options
+		report := newReportLocal(newWaitCycleStack(waiting, cycle))
+		printReports([]Report{report})
+		handleDeadlock(report, true)
+	}
 }
 
-// detectPeriodical starts the search for local deadlocks.
-// It uses depth-first search to search for cyclic chains in the set of
-// dependencies which contain the dependencies which were last added to each
-// routine
-// 	Args:
-//   lastHolding (*[]mutexInt): list with dependencies
+// buildWaitForGraph creates the wait-for graph of the waiting routines. A
+// routine w has an edge to a routine h, if h is waiting itself and holds the
+// lock w is waiting for in a way, that blocks w. A routine waiting for a
+// reader lock also has an edge to each routine waiting for the writer lock of
+// the same rw-lock, because a waiting writer blocks new readers. This finds
+// the deadlock of a recursive r-lock with a writer waiting in between. A
+// routine waiting for a condition variable has an edge to each routine which
+// signaled it before, if all of them are waiting.
+//  Args:
+//   waiting (map[int]waitInfo): waits of the routines by routine index
 //  Returns:
-//   nil
-func detectionPeriodical(lastHolding *[]mutexInt) {
-	// A stack is used to represent the currently explored path in the lock trees.
-	// A dependency is added to the path by pushing it on top of the stack.
-	stack := newDepStack()
+//   (map[int][]int): indices of the blocking routines for each waiting routine
+func buildWaitForGraph(waiting map[int]waitInfo) map[int][]int {
+	edges := make(map[int][]int)
+
+	for index, w := range waiting {
+		for i, c := range copyLockedRoutineIndex(w.m) {
+			h, ok := waiting[i]
+			if i == index || !ok {
+				continue
+			}
 
-	// every dependency can only be used once in the path
-	isTraversed := make([]bool, opts.maxRoutines)
+			// the acquisition is counted before the lock is acquired, therefore
+			// an acquisition of the holder which is still waiting is not held
+			if h.m == w.m {
+				c--
+			}
+			if c <= 0 {
+				continue
+			}
 
-	// traverse all routines as starting routine
-	for index, r := range routines {
-		// routines with an index >= routinesIndex have not been used in the program
-		if index >= numberRoutines {
-			break
-		}
+			// readers do not block each other
+			if w.rLock && w.m.getRLock(i) {
+				continue
+			}
 
-		// continue if the routine has not acquired a dependency
-		if r.curDep == nil {
-			continue
+			edges[index] = append(edges[index], i)
 		}
 
-		isTraversed[index] = true
+		// a routine waiting for a signal waits for the routines, which signaled
+		// the resource before. Each of them could signal it, therefore the
+		// edges are only added, if all of them are blocked
+		if res, ok := w.m.(*resource); ok {
+			edges[index] = append(edges[index],
+				getBlockedSignalers(res, index, waiting)...)
+		}
 
-		// add the dependency as first dependency of the path to the stack and
-		// start the recursive search for a cyclic path
-		stack.push(r.curDep, index)
-		dfsPeriodical(&stack, index, isTraversed, lastHolding)
+		// a waiting writer blocks all new readers of a rw-lock
+		if w.rLock {
+			for i, h := range waiting {
+				if i != index && h.m == w.m && !h.rLock {
+					edges[index] = append(edges[index], i)
+				}
+			}
+		}
 
-		// if no cycle is found with this dependency it is removed from the path
-		stack.pop()
-		r.curDep = nil
+		sort.Ints(edges[index])
 	}
+
+	return edges
 }
 
-// dfsPeriodical runs the recursive depth-first search.
-// Only paths which build a valid chain are explored.
-// After a new dependency is added to the currently explored path, it is checked,
-// if the path forms a circle.
+// get the indices of the routines which signaled res before, if all of them
+// are blocked. A routine which is not tracked anymore or does not wait could
+// still signal res.
 //  Args:
-//   stack (*depStack): stack witch represent the currently explored path
-//   visiting int: index of the routine of the first element in the currently explored path
-//   isTraversed (*([]bool)): list which stores which routines have already been traversed
-//    (either as starting routine or as a routine which already has a dep in the current path)
-//   lastHolding (*[]mutexInt): list with dependencies
+//   res (*resource): resource a routine waits for
+//   index (int): index of the waiting routine
+//   waiting (map[int]waitInfo): waits of the routines by routine index
 //  Returns:
-//   nil
-func dfsPeriodical(stack *depStack, visiting int, isTraversed []bool,
-	lastHolding *[]mutexInt) {
-	// Traverse through all routines to find the potential next step in the path.
-	// Routines with index <= visiting have already been used as starting routine
-	// and therefore don't have to been considered again.
-	for i := visiting + 1; i < numberRoutines; i++ {
-		r := routines[i]
-
-		// continue if the routine has no current dependency or has already be traversed
-		if r.curDep == nil || isTraversed[i] {
-			continue
-		}
+//   ([]int): indices of the signalers, nil if one of them is not blocked
+func getBlockedSignalers(res *resource, index int, waiting map[int]waitInfo) []int {
+	ids := res.getSignalers()
+	if len(ids) == 0 {
+		return nil
+	}
 
-		dep := r.curDep
+	indices := make(map[int64]int, len(waiting))
+	for i, w := range waiting {
+		indices[w.r.id] = i
+	}
 
-		// check if adding dep to the current path would lead to a valid dependency
-		// chain
-		if !isChain(stack, dep, i) {
-			continue
+	var signalers []int
+	for _, id := range ids {
+		i, ok := indices[id]
+		if !ok {
+			return nil
 		}
+		if i != index {
+			signalers = append(signalers, i)
+		}
+	}
+	return signalers
+}
 
-		// check if adding dep to the curring path would lead to a cyclic dependency
-		// chain. This would indicate a deadlock.
-		if isCycleChain(stack, dep, i) {
-			stack.push(dep, i)
-
-			// check if the last added dependency in on of the routines in the path
-			// has changed since the beginning of the detection. In this case, the
-			// program will assume it was a false alarm and will not terminate the
-			// program
-			sthNew := false
-
-			// traverse alle routines in the current dependency chain
-			for cl := stack.stack.next; cl != nil; cl = cl.next {
-				routineInChain := routines[cl.index]
-
-				// check if the last added dependency has changed
-				holds := routineInChain.holdingCount - 1
-				if (holds >= 0 &&
-					(*lastHolding)[cl.index] != routineInChain.holdingSet[holds]) ||
-					(holds < 0 && (*lastHolding)[cl.index] != nil) {
-					sthNew = true
-					break
+// findWaitCycles searches for cycles in the wait-for graph with a depth-first
+// search. Each routine is part of at most one returned cycle.
+//  Args:
+//   waiting (map[int]waitInfo): waits of the routines by routine index
+//   edges (map[int][]int): wait-for graph
+//  Returns:
+//   ([][]int): found cycles as lists of routine indices. Each routine waits for
+//    a lock held by the next routine in the list
+func findWaitCycles(waiting map[int]waitInfo, edges map[int][]int) [][]int {
+	var cycles [][]int
+
+	// 0: not visited, 1: on the current path, 2: completely explored
+	state := make(map[int]int)
+	var path []int
+
+	var visit func(index int)
+	visit = func(index int) {
+		state[index] = 1
+		path = append(path, index)
+
+		for _, next := range edges[index] {
+			switch state[next] {
+			case 0:
+				visit(next)
+			case 1:
+				// next is on the current path, the path from next to index
+				// is a cycle
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == next {
+						cycles = append(cycles, append([]int(nil), path[i:]...))
+						break
+					}
 				}
 			}
+		}
 
-			// if nothing has changed the program assumes a deadlock.
-			// Therefore it reports the deadlock, starts the comprehensive detection
-			// to search for other possible deadlocks and terminates the program.
-			if !sthNew {
-				reportDeadlockPeriodical()
-				FindPotentialDeadlocks()
-				os.Exit(2)
+		path = path[:len(path)-1]
+		state[index] = 2
+	}
+
+	// traverse the routines in a fixed order to get deterministic reports
+	indices := make([]int, 0, len(waiting))
+	for index := range waiting {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		if state[index] == 0 {
+			visit(index)
+		}
+	}
+
+	return cycles
+}
+
+// newWaitCycleStack creates the dependency stack for a cycle in the wait-for
+// graph, which can be used to create the report of the deadlock. The
+// dependency of a routine consists of the lock it waits for and the locks it
+// holds.
+//  Args:
+//   waiting (map[int]waitInfo): waits of the routines by routine index
+//   cycle ([]int): indices of the routines in the cycle
+//  Returns:
+//   (*depStack): stack which represents the cycle
+func newWaitCycleStack(waiting map[int]waitInfo, cycle []int) *depStack {
+	stack := newDepStack()
+	for _, index := range cycle {
+		w := waiting[index]
+
+		// the waited for lock is already in the holding set of the routine
+		w.r.lock.Lock()
+		hs := make([]mutexInt, 0, w.r.holdingCount)
+		removed := false
+		for i := w.r.holdingCount - 1; i >= 0; i-- {
+			h := w.r.holdingSet[i]
+			if h == w.m && !removed {
+				removed = true
+				continue
 			}
-			stack.pop()
-		} else {
-			// if the chain is not a cycle, the dependency is added to the current
-			// path and the search is continued recursively
-			isTraversed[numberRoutines] = true
-			stack.push(dep, numberRoutines)
-			dfsPeriodical(stack, visiting, isTraversed, lastHolding)
-
-			// if no cycle has been found with dep, it is removed from the path
-			stack.pop()
-			isTraversed[numberRoutines] = false
+			hs = append([]mutexInt{h}, hs...)
 		}
+		w.r.lock.Unlock()
+
+		dep := newDependency(w.m, w.rLock, hs, w.r.getRLocks(hs), len(hs))
+		stack.push(&dep, index)
 	}
+	return &stack
 }
 
 // ================ Checks for chains and Cycles ================
@@ -422,15 +563,16 @@ func dfsPeriodical(stack *depStack, visiting int, isTraversed []bool,
 // holdings sets of two different dependencies in the path, such that the locks
 // are equal. This would be a gate lock situation. For RW-Locks this is not
 // true if both of the locks were acquired with RLock, because RLocks don't
-// have to work as gate locks
+// have to work as gate locks. The same is true for resources, which can be
+// held by many routines at the same time. The dependencies in a valid path must also be
+// able to happen concurrently according to the vector clocks of the routines.
 //  Args:
 //   stack (*depStack): stack representing the current path
 //   dep (*dependency): dependency for which it should be checked if it can be
 //    added to the path
-//   routineIndex (int): index of the routine the dependency is from
 //  Returns:
 //   (bool): true if dep can be added to the current path, false otherwise
-func isChain(stack *depStack, dep *dependency, routineIndex int) bool {
+func isChain(stack *depStack, dep *dependency) bool {
 	// the mutex of the depEntry at the top of the stack mut be in the
 	// holding set of dep
 	found := false
@@ -438,7 +580,7 @@ func isChain(stack *depStack, dep *dependency, routineIndex int) bool {
 		mutexInHs := dep.holdingSet[i]
 		if mutexHaveEqualLock(mutexInHs, stack.top.depEntry.mu) {
 			// if mutexInHs is read, the mutex at the top of the stack can not also be read
-			if !(mutexInHs.getRLock(routineIndex) && stack.top.depEntry.mu.getRLock(stack.top.index)) {
+			if !(dep.holdingRLock[i] && stack.top.depEntry.rLock) {
 				found = true
 				break
 			}
@@ -454,14 +596,24 @@ func isChain(stack *depStack, dep *dependency, routineIndex int) bool {
 			return false
 		}
 
+		// dependencies which are ordered by the start or join of a routine
+		// can not be part of the same deadlock
+		if !isConcurrent(c.depEntry, dep) {
+			return false
+		}
+
 		// If two holding sets contain the same mutex they both have to be rLock
-		// (gate lock)
+		// (gate lock). Resources are held by many routines at the same time
+		// (e.g. all workers of a wait group), so they are never gate locks
 		for i := 0; i < dep.holdingCount; i++ {
+			if _, ok := dep.holdingSet[i].(*resource); ok {
+				continue
+			}
 			for j := 0; j < c.depEntry.holdingCount; j++ {
 				lockInDepHs := dep.holdingSet[i]
 				lockInCHoldingSet := c.depEntry.holdingSet[j]
 				if mutexHaveEqualLock(lockInDepHs, lockInCHoldingSet) {
-					if !(lockInCHoldingSet.getRLock(c.index) && lockInDepHs.getRLock(routineIndex)) {
+					if !(c.depEntry.holdingRLock[j] && dep.holdingRLock[i]) {
 						return false
 					}
 				}
@@ -479,17 +631,16 @@ func isChain(stack *depStack, dep *dependency, routineIndex int) bool {
 // does not indicate a potential deadlock. In this case, the function assumes,
 // that the path does not create a valid cyclic chain.
 //  isCycleChain assumes, that adding dep to the path results to a valid path
-//  (see isChain)
+//  (see isChain), so that all dependencies in the path can happen concurrently
 // Args:
 //  stack (*depStack): stack representing the current path
 //  dep (*dependency): dependency for which it should be checked if adding dep
 //   to the path would lead to a cyclic path
-//  routineIndex (int): index of the routine from which dep originated
 // Returns:
 //  (bool): true if dep can be added to the current path to create a valid cyclic
 //   chain, false if the path is no cycle, or it contains RW-lock with which
 //   the cycle does not indicate a deadlock
-func isCycleChain(dStack *depStack, dep *dependency, routineIndex int) bool {
+func isCycleChain(dStack *depStack, dep *dependency) bool {
 	// the mutex dep must be in the holding set of the depEntry at the bottom of
 	// the stack
 	found := false
@@ -497,7 +648,7 @@ func isCycleChain(dStack *depStack, dep *dependency, routineIndex int) bool {
 		mutexInHs := dStack.stack.next.depEntry.holdingSet[i]
 		if mutexHaveEqualLock(mutexInHs, dep.mu) {
 			// if mutexInHs is read, the mutex at the top of the stack can not also be read
-			if !(mutexInHs.getRLock(dStack.stack.index) && dep.mu.getRLock(routineIndex)) {
+			if !(dStack.stack.next.depEntry.holdingRLock[i] && dep.rLock) {
 				found = true
 				break
 			}
@@ -506,21 +657,13 @@ func isCycleChain(dStack *depStack, dep *dependency, routineIndex int) bool {
 	return found
 }
 
+// mutexHaveEqualLock checks if two locks are equal. If lock classes are
+// enabled, two locks are equal if they have the same class.
+//  Args:
+//   m1 (mutexInt): first lock
+//   m2 (mutexInt): second lock
+//  Returns:
+//   (bool): true if the locks are equal, false otherwise
 func mutexHaveEqualLock(m1, m2 mutexInt) bool {
-	isMutex1, mutex1, rwmutex1 := m1.getLock()
-	isMutex2, mutex2, rwmutex2 := m2.getLock()
-
-	if isMutex1 != isMutex2 {
-		return false
-	}
-
-	if isMutex1 && (mutex1 == mutex2) {
-		return true
-	}
-
-	if !isMutex1 && (rwmutex1 == rwmutex2) {
-		return true
-	}
-
-	return false
+	return lockKey(m1) == lockKey(m2)
 }
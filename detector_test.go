@@ -0,0 +1,51 @@
+package deadlock
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPeriodicalDetectionIgnoresTimedWaits(t *testing.T) {
+	a := NewLockNamed("timed-wait-a")
+	b := NewLockNamed("timed-wait-b")
+
+	// two routines wait for each other with a timeout
+	var held, done sync.WaitGroup
+	held.Add(2)
+	done.Add(2)
+	acquired := make([]bool, 2)
+	for i, locks := range [][2]*Mutex{{a, b}, {b, a}} {
+		go func(i int, first, second *Mutex) {
+			defer done.Done()
+			first.Lock()
+			held.Done()
+			held.Wait()
+			acquired[i] = second.LockTimeout(500 * time.Millisecond)
+			if acquired[i] {
+				second.Unlock()
+			}
+			first.Unlock()
+		}(i, locks[0], locks[1])
+	}
+
+	// the routines are waiting in two consecutive runs of the detection
+	held.Wait()
+	time.Sleep(50 * time.Millisecond)
+	state := newPeriodicalState()
+	periodicalDetection(state)
+	periodicalDetection(state)
+	done.Wait()
+
+	if acquired[0] && acquired[1] {
+		t.Fatal("both timed acquisitions succeeded")
+	}
+	output := outputString()
+	if strings.Contains(output, "LOCAL DEADLOCK") {
+		t.Error("timed waits were reported as local deadlock")
+	}
+	if !strings.Contains(output, "(name timed-wait-a)") {
+		t.Error("the timeout of the waits was not reported")
+	}
+}
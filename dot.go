@@ -0,0 +1,142 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+dot.go
+This file implements the export of the lock-order graph in the DOT format of
+Graphviz. The graph contains a node for every lock (or lock class, if lock
+classes are enabled) which was part of a
+dependency and an edge from each lock in the holding set of a dependency to
+the lock of the dependency. Cycles found by the comprehensive detection are
+highlighted.
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// key of an edge in the lock-order graph
+type dotEdge struct {
+	// index of the node of the held lock
+	from int
+	// index of the node of the acquired lock
+	to int
+	// label of the edge
+	label string
+}
+
+// WriteLockGraph writes the lock-order graph created from the lock trees of
+// all routines as DOT to w. Nodes are labeled with the creation of the lock,
+// edges with the acquisition and the index of the routine. Locks and edges
+// which are part of a potential deadlock are colored red.
+//  Args:
+//   w (io.Writer): writer to write the graph to
+//  Returns:
+//   (error): error of the writer, nil if the graph was written successfully
+func WriteLockGraph(w io.Writer) error {
+	// indices of the nodes for the locks
+	nodes := make(map[uintptr]int)
+	// locks in the order of their indices
+	var locks []mutexInt
+	// edges of the graph in the order they were found
+	var edges []dotEdge
+	isEdge := make(map[dotEdge]struct{})
+
+	// get the index of the node for m, create the node if necessary
+	node := func(m mutexInt) int {
+		key := lockKey(m)
+		if index, ok := nodes[key]; ok {
+			return index
+		}
+		nodes[key] = len(locks)
+		locks = append(locks, m)
+		return len(locks) - 1
+	}
+
+	rs := getAllRoutines()
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		for j := 0; j < r.depCount; j++ {
+			dep := r.dependencies[j]
+			to := node(dep.mu)
+			label := fmt.Sprintf("%s:%d (routine %d)", dep.caller.file,
+				dep.caller.line, i)
+			for k := 0; k < dep.holdingCount; k++ {
+				e := dotEdge{from: node(dep.holdingSet[k]), to: to, label: label}
+				if _, ok := isEdge[e]; !ok {
+					isEdge[e] = struct{}{}
+					edges = append(edges, e)
+				}
+			}
+		}
+	}
+
+	// find the locks and edges which are part of a cycle
+	cycleNodes := make(map[int]struct{})
+	cycleEdges := make(map[[2]int]struct{})
+	if len(rs) > 1 {
+		for _, report := range detect(rs) {
+			for k, dep := range report.cycle {
+				next := report.cycle[(k+1)%len(report.cycle)]
+				from, to := node(dep.mu), node(next.mu)
+				cycleNodes[from] = struct{}{}
+				cycleEdges[[2]int{from, to}] = struct{}{}
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph locks {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	for i, m := range locks {
+		creation := getCreation(m)
+		label := strconv.Quote(fmt.Sprintf("%s:%d", creation.file, creation.line))
+		if opts.lockClasses {
+			label = strconv.Quote(lockClass(m))
+		} else if name := m.getName(); name != "" {
+			label = strconv.Quote(fmt.Sprintf("%s\n%s:%d", name, creation.file, creation.line))
+		}
+		if _, ok := cycleNodes[i]; ok {
+			fmt.Fprintf(bw, "\tl%d [label=%s, color=red];\n", i, label)
+		} else {
+			fmt.Fprintf(bw, "\tl%d [label=%s];\n", i, label)
+		}
+	}
+	for _, e := range edges {
+		label := strconv.Quote(e.label)
+		if _, ok := cycleEdges[[2]int{e.from, e.to}]; ok {
+			fmt.Fprintf(bw, "\tl%d -> l%d [label=%s, color=red, penwidth=2];\n",
+				e.from, e.to, label)
+		} else {
+			fmt.Fprintf(bw, "\tl%d -> l%d [label=%s];\n", e.from, e.to, label)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
@@ -0,0 +1,439 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+export.go
+This file implements the machine-readable output formats for reports of
+detected deadlocks. Reports can be printed as JSON or as SARIF 2.1.0 log,
+which can be used to show deadlocks as annotations in code review tools.
+Reports are printed while the program runs, so JSON is written as newline
+delimited JSON with one report per line. The SARIF reports are collected and
+written as one log with one run by FlushReports, which is called by
+FindPotentialDeadlocks at the end of the program. Warnings of the detector are
+written to stderr in these formats, so that the output only contains JSON.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// lock to prevent that concurrently printed reports are mixed. It also
+// protects sarifReports
+var exportLock sync.Mutex
+
+// ============ JSON ============
+
+// print reports as JSON, one report per line
+//  Args:
+//   reports ([]Report): reports to print
+//  Returns:
+//   nil
+func printReportsJSON(reports []Report) {
+	lines := make([]interface{}, 0, len(reports))
+	for _, r := range reports {
+		lines = append(lines, r)
+	}
+	writeJSON(lines...)
+}
+
+// write each value as one line of JSON to the output. The lines are written
+// with one call of Write
+//  Args:
+//   values (...interface{}): values to write
+//  Returns:
+//   nil
+func writeJSON(values ...interface{}) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintln(os.Stderr, "Deadlock-Go: could not encode report:", err)
+			return
+		}
+	}
+	writeOutput(buf.Bytes())
+}
+
+// write p to the output with one call of Write while exportLock is held
+//  Args:
+//   p ([]byte): data to write
+//  Returns:
+//   nil
+func writeOutput(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+
+	exportLock.Lock()
+	opts.output.Write(p)
+	exportLock.Unlock()
+}
+
+// ============ SARIF ============
+
+// types for the parts of the SARIF 2.1.0 format used by the detector
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// rule ids for the deadlock types
+var sarifRuleIDs = map[DeadlockType]string{
+	DeadlockPotential:            "potential-deadlock",
+	DeadlockDoubleLocking:        "double-locking",
+	DeadlockLocal:                "local-deadlock",
+	DeadlockLockOrderInversion:   "lock-order-inversion",
+	DeadlockTimeout:              "lock-timeout",
+	DeadlockLongWait:             "long-lock-wait",
+	DeadlockLongHold:             "long-lock-hold",
+	DeadlockRecursiveRLock:       "recursive-read-locking",
+	DeadlockUnlockNotLocked:      "unlock-not-locked",
+	DeadlockUnlockByOtherRoutine: "unlock-by-other-routine",
+	DeadlockUnbalancedUnlock:     "unbalanced-unlock",
+	DeadlockLockLeak:             "lock-leak",
+	DeadlockHeldLocks:            "held-locks",
+}
+
+// reports collected for the SARIF log, which is written by FlushReports
+var sarifReports []Report
+
+// collect reports for the SARIF log
+//  Args:
+//   reports ([]Report): reports to add to the log
+//  Returns:
+//   nil
+func printReportsSARIF(reports []Report) {
+	exportLock.Lock()
+	sarifReports = append(sarifReports, reports...)
+	exportLock.Unlock()
+}
+
+// FlushReports writes the collected reports as one SARIF 2.1.0 log to the
+// output, if the output format is FormatSARIF. It is called by
+// FindPotentialDeadlocks and before the program is terminated by the
+// detector. The log is written even if no reports were collected. Reports
+// which are found afterwards are written by the next call.
+//  Returns:
+//   nil
+func FlushReports() {
+	if opts.outputFormat != FormatSARIF {
+		return
+	}
+
+	exportLock.Lock()
+	defer exportLock.Unlock()
+
+	log, err := json.MarshalIndent(newSarifLog(sarifReports), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Deadlock-Go: could not encode report:", err)
+		return
+	}
+	sarifReports = nil
+	opts.output.Write(append(log, '\n'))
+}
+
+// create a SARIF log from reports
+//  Args:
+//   reports ([]Report): reports to add to the log
+//  Returns:
+//   (sarifLog): the created SARIF log
+func newSarifLog(reports []Report) sarifLog {
+	rules := []sarifRule{}
+	for _, t := range []DeadlockType{DeadlockPotential, DeadlockDoubleLocking,
+		DeadlockLocal, DeadlockLockOrderInversion, DeadlockTimeout,
+		DeadlockLongWait, DeadlockLongHold, DeadlockRecursiveRLock,
+		DeadlockUnlockNotLocked, DeadlockUnlockByOtherRoutine,
+		DeadlockUnbalancedUnlock, DeadlockLockLeak, DeadlockHeldLocks} {
+		rules = append(rules, sarifRule{
+			ID:               sarifRuleIDs[t],
+			ShortDescription: sarifMessage{Text: t.String()},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, r := range reports {
+		results = append(results, newSarifResult(r))
+	}
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "Deadlock-Go",
+			InformationURI: "https://github.com/ErikKassubek/Deadlock-Go",
+			Rules:          rules,
+		}},
+		Results: results,
+	}
+	if root := getSourceRoot(); root != "" {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{
+			sarifSourceRoot: {URI: fileURI(root) + "/"},
+		}
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
+
+// create a SARIF result for a report. Every acquisition of a lock involved
+// in the deadlock is added as location of the result, the creations of the
+// locks are added as related locations.
+//  Args:
+//   r (Report): report to convert
+//  Returns:
+//   (sarifResult): the created result
+func newSarifResult(r Report) sarifResult {
+	level := "error"
+	if r.Type != DeadlockDoubleLocking && r.Type != DeadlockLocal {
+		level = "warning"
+	}
+
+	res := sarifResult{
+		RuleID:           sarifRuleIDs[r.Type],
+		Level:            level,
+		Message:          sarifMessage{Text: sarifResultMessage(r)},
+		Locations:        []sarifLocation{},
+		RelatedLocations: []sarifLocation{},
+	}
+
+	for i, lr := range r.Locks {
+		for _, a := range lr.Acquisitions {
+			loc := newSarifLocation(a)
+			loc.Message = &sarifMessage{Text: fmt.Sprintf(
+				"acquisition of lock %d created at %s:%d", i+1,
+				sarifPath(lr.Creation.File), lr.Creation.Line)}
+			res.Locations = append(res.Locations, loc)
+		}
+
+		if lr.Release != nil {
+			loc := newSarifLocation(*lr.Release)
+			loc.Message = &sarifMessage{Text: fmt.Sprintf(
+				"release of lock %d created at %s:%d", i+1,
+				sarifPath(lr.Creation.File), lr.Creation.Line)}
+			res.Locations = append(res.Locations, loc)
+		}
+
+		loc := newSarifLocation(lr.Creation)
+		loc.ID = i + 1
+		loc.Message = &sarifMessage{Text: fmt.Sprintf("creation of lock %d%s", i+1,
+			lockAnnotation(lr))}
+		res.RelatedLocations = append(res.RelatedLocations, loc)
+	}
+
+	return res
+}
+
+// create the message of a SARIF result
+//  Args:
+//   r (Report): report of the result
+//  Returns:
+//   (string): message of the result
+func sarifResultMessage(r Report) string {
+	msg := fmt.Sprintf("%s involving %d lock(s):", r.Type, len(r.Locks))
+	for i, lr := range r.Locks {
+		msg += fmt.Sprintf(" [lock %d](%d)", i+1, i+1)
+		if lr.Routine >= 0 {
+			msg += fmt.Sprintf(" in routine %d", lr.Routine)
+		}
+	}
+	return msg
+}
+
+// create a SARIF location from a location. Files in the source root are
+// given relative to it
+//  Args:
+//   l (Location): location in the code
+//  Returns:
+//   (sarifLocation): the SARIF location
+func newSarifLocation(l Location) sarifLocation {
+	artifact := sarifArtifactLocation{URI: fileURI(l.File)}
+	if rel, ok := relativeToSourceRoot(l.File); ok {
+		artifact = sarifArtifactLocation{URI: rel, URIBaseID: sarifSourceRoot}
+	}
+
+	return sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: artifact,
+			Region:           sarifRegion{StartLine: l.Line},
+		},
+	}
+}
+
+// get the path of a file relative to the source root
+//  Args:
+//   file (string): path of the file
+//  Returns:
+//   (string): relative path of the file with forward slashes
+//   (bool): true if the file is in the source root
+func relativeToSourceRoot(file string) (string, bool) {
+	root := getSourceRoot()
+	if root == "" || !filepath.IsAbs(file) {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// get the path of a file for the messages in the SARIF log
+//  Args:
+//   file (string): path of the file
+//  Returns:
+//   (string): path relative to the source root if possible, file otherwise
+func sarifPath(file string) string {
+	if rel, ok := relativeToSourceRoot(file); ok {
+		return rel
+	}
+	return file
+}
+
+// id of the base of the relative uris in the SARIF log
+const sarifSourceRoot = "%SRCROOT%"
+
+// root directory of the sources, determined on the first use
+var sourceRoot string
+var sourceRootOnce sync.Once
+
+// get the root directory of the sources. This is the first directory
+// containing .git or, if there is none, go.mod, starting from the working
+// directory
+//  Returns:
+//   (string): root directory, empty if the working directory is unknown
+func getSourceRoot() string {
+	sourceRootOnce.Do(func() {
+		wd, err := os.Getwd()
+		if err != nil {
+			return
+		}
+		sourceRoot = wd
+		for _, marker := range []string{".git", "go.mod"} {
+			if dir, ok := findParentWith(wd, marker); ok {
+				sourceRoot = dir
+				return
+			}
+		}
+	})
+	return sourceRoot
+}
+
+// find the first directory starting from dir, which contains name
+//  Args:
+//   dir (string): directory to start from
+//   name (string): name of the file or directory to find
+//  Returns:
+//   (string): the found directory
+//   (bool): true if a directory was found
+func findParentWith(dir string, name string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// convert a file path into an uri
+//  Args:
+//   file (string): path of the file
+//  Returns:
+//   (string): uri of the file
+func fileURI(file string) string {
+	if filepath.IsAbs(file) {
+		path := filepath.ToSlash(file)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return "file://" + path
+	}
+	return filepath.ToSlash(file)
+}
@@ -30,40 +30,65 @@ and periodically run the periodical deadlock detection.
 */
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// global variable to check whether the detector was already initialized
-var initialized = false
+// global variable to check whether the detector was already initialized. It
+// is set to 1 by the initialization and only accessed atomically
+var initialized uint32 = 0
 
-// initialize initializes the deadlock detector.
-// This starts the periodical detection.
+// makes sure, that the detector is only initialized once
+var initializeOnce sync.Once
+
+// initialize initializes the deadlock detector, if it has not been initialized
+// yet. This starts the periodical detection.
 //  Returns:
 //   nil
 func initialize() {
-	initialized = true
+	initializeOnce.Do(initializeDetector)
+}
 
-	// reinitialize routines to set size
-	routines = make([]routine, opts.maxRoutines)
+// check whether the detector was already initialized
+//  Returns:
+//   (bool): true if the detector was initialized, false otherwise
+func isInitialized() bool {
+	return atomic.LoadUint32(&initialized) == 1
+}
+
+// initializeDetector runs the initialization of the deadlock detector.
+//  Returns:
+//   nil
+func initializeDetector() {
+	atomic.StoreUint32(&initialized, 1)
 
-	// return if periodical detection is disabled
-	if !opts.periodicDetection {
+	// return if periodical detection and the watchdog are disabled
+	if !opts.periodicDetection && !watchdogEnabled() {
 		return
 	}
 
 	// go routine to run the periodical detection in the background
+	// The slots of terminated routines are also reclaimed periodically and the
+	// hold and wait times of the locks are checked by the watchdog
 	go func() {
 		// timer to send a signals at equal intervals
 		timer := time.NewTicker(opts.periodicDetectionTime)
 
-		// initialize lashHolding. This slice stores the dependencies which were
-		// considered in the last detection round, so that the detection only takes
-		// place, if the situation has changed
-		lastHolding := make([]mutexInt, opts.maxRoutines)
+		// initialize the state of the periodical detection. It stores the waits
+		// which were considered in the last detection round, so that only
+		// routines which are blocked since then are considered
+		state := newPeriodicalState()
 
 		// run the periodical detection if a timer signal is received
 		for range timer.C {
-			periodicalDetection(&lastHolding)
+			if opts.periodicDetection {
+				reclaimRoutines()
+				periodicalDetection(state)
+			}
+			if watchdogEnabled() {
+				checkWatchdog()
+			}
 		}
 	}()
 }
@@ -0,0 +1,210 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+leak.go
+This file implements the detection of lock leaks. A routine which terminates
+while holding a lock is reported, either directly when the function of a
+routine started with Go returns, or when the slot of the terminated routine
+is reclaimed. The comprehensive detection additionally lists all locks which
+are still held at the end of the program.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// reports of the routines which terminated while holding locks. Leaks of
+// locks with the same creations and acquisitions are only kept once, so that
+// the list does not grow with each routine
+var leakReports []Report
+
+// keys of the leaks in leakReports
+var leakReportKeys = make(map[string]struct{})
+
+// lock to prevent concurrent access to leakReports and leakReportKeys
+var leakReportsLock sync.Mutex
+
+// get the locks which are held by r and the positions of their acquisitions.
+// Resources and the lock r is currently waiting for are not held.
+//  Returns:
+//   ([]mutexInt): held locks
+//   ([]callerInfo): positions of the acquisitions of the held locks
+func (r *routine) getHeldLocks() ([]mutexInt, []callerInfo) {
+	waiting, _, _, _ := r.getWaiting()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var held []mutexInt
+	var info []callerInfo
+	for i := r.holdingCount - 1; i >= 0; i-- {
+		m := r.holdingSet[i]
+		if _, ok := m.(*resource); ok {
+			continue
+		}
+
+		// the lock the routine waits for is already in the holding set
+		if m == waiting {
+			waiting = nil
+			continue
+		}
+
+		held = append([]mutexInt{m}, held...)
+		info = append([]callerInfo{r.holdingInfo[i]}, info...)
+	}
+	return held, info
+}
+
+// newReportHeldLocks creates the report for the locks held by r
+//  Args:
+//   t (DeadlockType): DeadlockLockLeak or DeadlockHeldLocks
+//   r (*routine): routine which holds the locks
+//  Returns:
+//   (Report): the created report
+//   (bool): false if r does not hold any lock, true otherwise
+func newReportHeldLocks(t DeadlockType, r *routine) (Report, bool) {
+	held, info := r.getHeldLocks()
+	if len(held) == 0 {
+		return Report{}, false
+	}
+
+	report := Report{
+		Type:     t,
+		Routines: []RoutineReport{{Routine: r.index, ID: r.id}},
+	}
+	for i, m := range held {
+		lr := newLockReport(m, r.index)
+		lr.Acquisitions = []Location{{File: info[i].file, Line: info[i].line}}
+		lr.CallStacks = nil
+		report.Locks = append(report.Locks, lr)
+	}
+	return report, true
+}
+
+// report the lock leak of the routine r, which has terminated, if it holds
+// locks and was not reported before
+//  Args:
+//   r (*routine): terminated routine
+//  Returns:
+//   nil
+func reportLockLeak(r *routine) {
+	if report, ok := newReportLockLeak(r); ok {
+		printReports([]Report{report})
+	}
+}
+
+// create the report of the lock leak of the routine r, which has terminated,
+// and save it in leakReports, if no leak with the same locks was saved
+// before. The report is only created once for each routine
+//  Args:
+//   r (*routine): terminated routine
+//  Returns:
+//   (Report): the created report
+//   (bool): true if r holds locks and the leak was not reported before
+func newReportLockLeak(r *routine) (Report, bool) {
+	// the leak can be reported by the terminating routine and by the reclamation
+	// of its slot
+	r.lock.Lock()
+	reported := r.leakReported
+	r.leakReported = true
+	r.lock.Unlock()
+	if reported {
+		return Report{}, false
+	}
+
+	report, ok := newReportHeldLocks(DeadlockLockLeak, r)
+	if !ok {
+		return Report{}, false
+	}
+
+	key := getLeakKey(report)
+	leakReportsLock.Lock()
+	if _, ok := leakReportKeys[key]; !ok {
+		leakReportKeys[key] = struct{}{}
+		leakReports = append(leakReports, report)
+	}
+	leakReportsLock.Unlock()
+
+	return report, true
+}
+
+// get the key of a lock leak, which consists of the creations and the
+// acquisitions of the leaked locks
+//  Args:
+//   report (Report): report of the lock leak
+//  Returns:
+//   (string): key of the leak
+func getLeakKey(report Report) string {
+	var key strings.Builder
+	for _, lr := range report.Locks {
+		fmt.Fprintf(&key, "%s:%d", lr.Creation.File, lr.Creation.Line)
+		for _, a := range lr.Acquisitions {
+			fmt.Fprintf(&key, ",%s:%d", a.File, a.Line)
+		}
+		key.WriteString(";")
+	}
+	return key.String()
+}
+
+// report the lock leak of the current routine, which is about to terminate
+//  Returns:
+//   nil
+func reportLockLeakOnExit() {
+	if index := getRoutineIndex(); index != -1 {
+		reportLockLeak(getRoutine(index))
+	}
+}
+
+// get the reports of all locks which are still held. These are the locks
+// held by the tracked routines and the locks leaked by terminated routines
+//  Returns:
+//   ([]Report): reports of the held locks, one for each routine
+func getHeldLockReports() []Report {
+	var reports []Report
+
+	createRoutineLock.Lock()
+	for index := 0; index < numberRoutines; index++ {
+		r := routines[index]
+		r.lock.Lock()
+		reported := r.leakReported
+		r.lock.Unlock()
+		if reported {
+			continue
+		}
+		if report, ok := newReportHeldLocks(DeadlockHeldLocks, r); ok {
+			reports = append(reports, report)
+		}
+	}
+	createRoutineLock.Unlock()
+
+	leakReportsLock.Lock()
+	reports = append(reports, leakReports...)
+	leakReportsLock.Unlock()
+
+	return reports
+}
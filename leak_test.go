@@ -0,0 +1,24 @@
+package deadlock
+
+import "testing"
+
+func TestLockLeakReportsAreDeduplicated(t *testing.T) {
+	leakReportsLock.Lock()
+	before := len(leakReports)
+	leakReportsLock.Unlock()
+
+	// the routines leak locks with the same creation and acquisition
+	for i := 0; i < 5; i++ {
+		m := NewLockNamed("leaked")
+		Go(func() {
+			m.Lock()
+		}).Join()
+	}
+
+	leakReportsLock.Lock()
+	added := len(leakReports) - before
+	leakReportsLock.Unlock()
+	if added != 1 {
+		t.Errorf("got %d saved leaks, want 1", added)
+	}
+}
@@ -0,0 +1,62 @@
+package deadlock
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// output of the detector during the tests. The detector writes it only while
+// exportLock is held, so the race detector finds unsynchronized writes
+var testOutput bytes.Buffer
+
+// get the output of the detector
+func outputString() string {
+	exportLock.Lock()
+	defer exportLock.Unlock()
+	return testOutput.String()
+}
+
+// The options can only be set before the detector is initialized, so they are
+// set once for all tests. The reports are printed as text into testOutput.
+// The small maximum number of routines makes the reclamation of terminated
+// routines necessary. The online detection and the watchdog are enabled, so
+// that they are used by all tests, but the thresholds of the watchdog are
+// never exceeded.
+func TestMain(m *testing.M) {
+	SetDeadlockResponse(ResponseContinue)
+	SetOutput(&testOutput)
+	SetColor(false)
+	SetUnlockDiagnostics(true)
+	SetPeriodicDetectionTime(1)
+	SetMaxRoutines(32)
+	SetOnlineDetection(true)
+	SetHoldTimeThreshold(time.Hour)
+	SetWaitTimeThreshold(time.Hour)
+	os.Exit(m.Run())
+}
+
+// get the reports of the comprehensive detection, which contain a lock with
+// the given name, and the reports printed so far, which mention the lock
+func reportsOfLock(t *testing.T, name string) []string {
+	t.Helper()
+
+	var found []string
+	for _, r := range GetPotentialDeadlocks() {
+		for _, lr := range r.Locks {
+			if lr.Name == name {
+				found = append(found, r.Type.String())
+				break
+			}
+		}
+	}
+
+	output := outputString()
+	if strings.Contains(output, "(name "+name+")") ||
+		strings.Contains(output, "(name "+name+",") {
+		found = append(found, "printed report")
+	}
+	return found
+}
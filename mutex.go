@@ -30,28 +30,41 @@ the lock and unlock operations for these locks.
 */
 
 import (
+	"context"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 // Type to implement a lock
-// It can be used as an drop in replacement
+// It can be used as an drop in replacement. The zero value is an unlocked
+// mutex, which gets initialized on its first use.
 type Mutex struct {
 	// mutex for the actual locking
-	mu *sync.Mutex
+	mu sync.Mutex
 	// info about the creation and lock/unlock of this lock
 	context []callerInfo
-	// set to true after lock was initialized
-	in bool
-	// numberLocked stores how often the mutex is currently locked
-	numberLocked int
+	// lock to prevent concurrent access to context, class and name
+	contextLock sync.Mutex
+	// set to 1 after lock was initialized
+	in uint32
+	// lock to prevent multiple concurrent initializations of the lock
+	inLock sync.Mutex
+	// numberLocked stores how often the mutex is currently locked, only
+	// accessed atomically
+	numberLocked int32
 	// index of the routine, which holds the lock
 	isLockedRoutineIndex map[int]int
 	// lock to prevent multiple concurrent writes to isLockedRoutineIndex
-	isLockedRoutineIndexLock *sync.Mutex
+	isLockedRoutineIndexLock sync.Mutex
 	// position of the mutex in memory
 	memoryPosition uintptr
+	// class of the lock, set with SetClass
+	class string
+	// name of the lock, set with SetName
+	name string
 }
 
 // create and return a new lock, which can be used as a drop-in replacement for
@@ -59,34 +72,66 @@ type Mutex struct {
 //  Returns:
 //   (*Mutex): the created lock
 func NewLock() *Mutex {
-	// initialize detector if necessary
-	if !initialized {
-		initialize()
+	m := &Mutex{}
+	m.init()
+	return m
+}
+
+// create and return a new named mutex. The name is used in all reports of
+// the lock. If lock classes are enabled and no class is set, the name is
+// also used as class of the lock.
+//  Args:
+//   name (string): name of the lock
+//  Returns:
+//   (*Mutex): the created lock
+func NewLockNamed(name string) *Mutex {
+	m := &Mutex{}
+	m.init()
+	m.name = name
+	return m
+}
+
+// init initializes the lock if it has not been initialized yet.
+// This allows the usage of a zero value Mutex. The position of the caller of
+// the function that called init (NewLock or the first Lock) is saved as
+// the creation of the lock.
+//  Returns:
+//   nil
+func (m *Mutex) init() {
+	// fast path if the lock is already initialized
+	if atomic.LoadUint32(&m.in) == 1 {
+		return
 	}
 
-	m := Mutex{
-		mu:                       &sync.Mutex{},
-		in:                       true,
-		isLockedRoutineIndex:     map[int]int{},
-		isLockedRoutineIndexLock: &sync.Mutex{},
+	m.inLock.Lock()
+	defer m.inLock.Unlock()
+
+	// another routine may have initialized the lock in the meantime
+	if m.in == 1 {
+		return
 	}
 
-	// save the position of the NewLock call
-	_, file, line, _ := runtime.Caller(1)
+	// initialize detector if necessary
+	initialize()
+
+	m.isLockedRoutineIndex = map[int]int{}
+
+	// save the position of the NewLock or first Lock call
+	_, file, line, _ := runtime.Caller(2)
 	m.context = append(m.context, newInfo(file, line, true, ""))
 
 	// save the memory position of the mutex
-	m.memoryPosition = uintptr(unsafe.Pointer(&m))
+	m.memoryPosition = uintptr(unsafe.Pointer(m))
 
-	return &m
+	atomic.StoreUint32(&m.in, 1)
 }
 
 // ============ GETTER ============
 
 // getter for isLocked
 //  Returns:
-//   (*int): numberLocked
-func (m *Mutex) getNumberLocked() *int {
+//   (*int32): numberLocked
+func (m *Mutex) getNumberLocked() *int32 {
 	return &m.numberLocked
 }
 
@@ -101,7 +146,7 @@ func (m *Mutex) getIsLockedRoutineIndex() *map[int]int {
 //  Returns:
 //   (*sync.RWMutex): isLockedRisLockedRoutineIndexLockoutineIndex
 func (m *Mutex) getIsLockedRoutineIndexLock() *sync.Mutex {
-	return m.isLockedRoutineIndexLock
+	return &m.isLockedRoutineIndexLock
 }
 
 // getter for context
@@ -111,6 +156,13 @@ func (m *Mutex) getContext() *[]callerInfo {
 	return &m.context
 }
 
+// getter for contextLock
+//  Returns:
+//   (*sync.Mutex): contextLock
+func (m *Mutex) getContextLock() *sync.Mutex {
+	return &m.contextLock
+}
+
 // getter for memoryPosition
 //  Returns:
 //   (uintptr): memoryPosition
@@ -118,11 +170,24 @@ func (m *Mutex) getMemoryPosition() uintptr {
 	return m.memoryPosition
 }
 
-// getter for in
+// getter for class
+//  Returns:
+//   (string): class of the lock, empty if no class was set
+func (m *Mutex) getClass() string {
+	m.contextLock.Lock()
+	defer m.contextLock.Unlock()
+
+	return m.class
+}
+
+// getter for name
 //  Returns:
-//   (bool): true if the lock was initialized, false otherwise
-func (m *Mutex) getIn() *bool {
-	return &m.in
+//   (string): name of the lock, empty if no name was set
+func (m *Mutex) getName() string {
+	m.contextLock.Lock()
+	defer m.contextLock.Unlock()
+
+	return m.name
 }
 
 // getter for mu
@@ -131,7 +196,7 @@ func (m *Mutex) getIn() *bool {
 //   (*sync.Mutex): underlying sync.Mutex mu
 //   (*sync.RWMutex): nil, underlying sync.RWMutex mu for rw-mutex
 func (m *Mutex) getLock() (bool, *sync.Mutex, *sync.RWMutex) {
-	return true, m.mu, nil
+	return true, &m.mu, nil
 }
 
 // empty getter, needed for MutexInt
@@ -145,18 +210,75 @@ func (m *Mutex) setRLock(routineIndex int, value bool) {}
 
 // ============ FUNCTIONS ============
 
+// SetClass sets the class of mutex m. If lock classes are enabled, all locks
+// with the same class share one node in the lock trees. Locks without a class
+// are grouped by the position of their creation.
+//  Args:
+//   class (string): name of the class
+//  Returns:
+//   nil
+func (m *Mutex) SetClass(class string) {
+	m.init()
+	m.contextLock.Lock()
+	m.class = class
+	m.contextLock.Unlock()
+}
+
+// SetName sets the name of mutex m. The name is used in all reports of the
+// lock.
+//  Args:
+//   name (string): name of the lock
+//  Returns:
+//   nil
+func (m *Mutex) SetName(name string) {
+	m.init()
+	m.contextLock.Lock()
+	m.name = name
+	m.contextLock.Unlock()
+}
+
 // Lock mutex m
 //  Returns:
 //   nil
 func (m *Mutex) Lock() {
+	m.init()
 	// call the lock function with the mutexInt interface
 	lockInt(m, false)
 }
 
+// LockContext locks mutex m, unless ctx is done before the lock could be
+// acquired. If the canceled acquisition is part of a potential deadlock, the
+// deadlock is reported.
+//  Args:
+//   ctx (context.Context): context of the acquisition
+//  Returns:
+//   (error): nil if m was locked, the error of ctx otherwise
+func (m *Mutex) LockContext(ctx context.Context) error {
+	m.init()
+	// call the lock function with the mutexInt interface
+	return lockContextInt(ctx, m, false)
+}
+
+// LockTimeout locks mutex m, unless the lock could not be acquired within the
+// duration d. If the canceled acquisition is part of a potential deadlock, the
+// deadlock is reported.
+//  Args:
+//   d (time.Duration): maximum time to wait for the lock
+//  Returns:
+//   (bool): true if locking was successful, false otherwise
+func (m *Mutex) LockTimeout(d time.Duration) bool {
+	m.init()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	// call the lock function with the mutexInt interface
+	return lockContextInt(ctx, m, false) == nil
+}
+
 // TryLock mutex m
 //  Returns:
 //   (bool): true if locking was successful, false otherwise
 func (m *Mutex) TryLock() bool {
+	m.init()
 	// call the try-lock method for the mutexInt interface
 	return tryLockInt(m, false)
 }
@@ -165,9 +287,10 @@ func (m *Mutex) TryLock() bool {
 //  Returns:
 //   nil
 func (m *Mutex) Unlock() {
+	m.init()
 	if opts.activated {
 		// call the unlock method for the mutexInt interface
-		unlockInt(m)
+		unlockInt(m, false)
 	}
 	m.mu.Unlock()
 }
@@ -1,9 +1,12 @@
 package deadlock
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
@@ -37,18 +40,22 @@ It also implements code which is used for both mutex and rw-mutex
 
 // creat and interface for Mutex and RWMutex
 type mutexInt interface {
-	// getter for isLocked
-	getNumberLocked() *int
+	// getter for isLocked, only accessed atomically
+	getNumberLocked() *int32
 	// getter for isLockedRoutineIndex
 	getIsLockedRoutineIndex() *map[int]int
 	// getter for isLockedRoutineIndexLock
 	getIsLockedRoutineIndexLock() *sync.Mutex
 	// getter for context
 	getContext() *[]callerInfo
+	// getter for contextLock
+	getContextLock() *sync.Mutex
 	// getter for memoryPosition
 	getMemoryPosition() uintptr
-	// getter for in (initialized)
-	getIn() *bool
+	// getter for class
+	getClass() string
+	// getter for name
+	getName() string
 	// getter for mu
 	// 	if bool is true, *sync.Mutex was returned, *sync.RWMutex is nil
 	// 	if bool is false, *sync.Mutex is nil, *sync.RWMutex ware returned
@@ -59,6 +66,13 @@ type mutexInt interface {
 	setRLock(routineIndex int, value bool)
 }
 
+// Mutex, RWMutex and the reader locker of RWMutex implement sync.Locker
+var (
+	_ sync.Locker = (*Mutex)(nil)
+	_ sync.Locker = (*RWMutex)(nil)
+	_ sync.Locker = (*rlocker)(nil)
+)
+
 // lock the mutex or rw-mutex and update the detector data
 //  Args:
 //   m (mutexInt): mutex or rw-mutex to lock
@@ -68,49 +82,77 @@ type mutexInt interface {
 func lockInt(m mutexInt, rLock bool) {
 	// do only the operation if detection is completely deactivated
 	if !opts.activated {
-		d, l, t := m.getLock()
-		if d {
-			// lock if m is mutex
-			l.Lock()
-		} else {
-			// lock if m is rw-mutex
-			if rLock {
-				t.RLock()
-			} else {
-				t.Lock()
-			}
-		}
+		acquire(m, rLock)
 		return
 	}
 
-	// panic if the lock was not initialized
-	if !*m.getIn() {
-		errorMessage := fmt.Sprint("Lock ", &m, " was not created. Use ",
-			"x := NewLock().")
-		panic(errorMessage)
+	// update the detector data before the actual locking
+	r := updateBeforeLock(m, rLock, false)
+
+	a := watchdogWait(m, rLock)
+	acquire(m, rLock)
+	watchdogGranted(a)
+	if r != nil {
+		r.stopWaiting()
 	}
+	atomic.AddInt32(m.getNumberLocked(), 1)
+}
 
-	// defer the actual locking
-	defer func() {
-		d, l, t := m.getLock()
-		if d {
-			// lock if m is mutex
-			l.Lock()
+// acquire the underlying mutex or rw-mutex of m
+//  Args:
+//   m (mutexInt): mutex or rw-mutex to lock
+//   rLock (bool): if set to true, the lock is a reader lock
+//  Returns:
+//   nil
+func acquire(m mutexInt, rLock bool) {
+	d, l, t := m.getLock()
+	if d {
+		// lock if m is mutex
+		l.Lock()
+	} else {
+		// lock if m is rw-mutex
+		if rLock {
+			t.RLock()
 		} else {
-			// lock if m is rw-mutex
-			if rLock {
-				t.RLock()
-			} else {
-				t.Lock()
-			}
+			t.Lock()
 		}
+	}
+}
 
-		*m.getNumberLocked() += 1
-	}()
+// release the underlying mutex or rw-mutex of m
+//  Args:
+//   m (mutexInt): mutex or rw-mutex to unlock
+//   rLock (bool): if set to true, the lock is released as reader lock
+//  Returns:
+//   nil
+func release(m mutexInt, rLock bool) {
+	d, l, t := m.getLock()
+	if d {
+		// unlock if m is mutex
+		l.Unlock()
+	} else {
+		// unlock if m is rw-mutex
+		if rLock {
+			t.RUnlock()
+		} else {
+			t.Unlock()
+		}
+	}
+}
 
+// update the detector data before m is locked. This checks for double locking,
+// adds the lock to the lock tree of the routine and records, that the routine
+// waits for m
+//  Args:
+//   m (mutexInt): mutex or rw-mutex to lock
+//   rLock (bool): if set to true, the lock is a reader lock
+//   cancelable (bool): true if the acquisition ends when its context is done
+//  Returns:
+//   (*routine): the routine which waits for m, nil if it is not tracked
+func updateBeforeLock(m mutexInt, rLock bool, cancelable bool) *routine {
 	// return if detection is disabled
 	if !opts.periodicDetection && !opts.comprehensiveDetection {
-		return
+		return nil
 	}
 
 	// create new routine, if not initialized
@@ -120,13 +162,23 @@ func lockInt(m mutexInt, rLock bool) {
 	}
 	index = getRoutineIndex()
 
-	r := &routines[index]
+	// the routine is not tracked if the maximum number of routines is reached
+	if index == -1 {
+		return nil
+	}
+
+	r := getRoutine(index)
 
 	// check if the locking would lead to double locking
-	if opts.checkDoubleLocking && *m.getNumberLocked() != 0 {
+	if opts.checkDoubleLocking && atomic.LoadInt32(m.getNumberLocked()) != 0 {
 		r.checkDoubleLocking(m, index, rLock)
 	}
 
+	// the routine is blocked until the lock is acquired. The wait is recorded
+	// before the acquisition is counted, so that an unlock by another routine
+	// does not take the waiting routine for the holder of m
+	r.startWaiting(m, rLock, cancelable)
+
 	m.getIsLockedRoutineIndexLock().Lock()
 	(*m.getIsLockedRoutineIndex())[index] += 1
 	m.getIsLockedRoutineIndexLock().Unlock()
@@ -136,6 +188,105 @@ func lockInt(m mutexInt, rLock bool) {
 	if numRoutine > 1 {
 		(*r).updateLock(m, rLock)
 	}
+	return r
+}
+
+// lock the mutex or rw-mutex and update the detector data. If ctx is done
+// before the lock could be acquired, the acquisition is canceled and the
+// detector data is reset. If the canceled acquisition is part of a potential
+// deadlock, the deadlock is reported.
+//  Args:
+//   ctx (context.Context): context of the acquisition
+//   m (mutexInt): mutex or rw-mutex to lock
+//   rLock (bool): if set to true, the lock is a reader lock
+//  Returns:
+//   (error): nil if the lock was acquired, the error of ctx otherwise
+func lockContextInt(ctx context.Context, m mutexInt, rLock bool) error {
+	// do only the operation if detection is completely deactivated
+	if !opts.activated {
+		return acquireContext(ctx, m, rLock)
+	}
+
+	// update the detector data before the actual locking. The wait is only
+	// cancelable, if ctx can be done
+	r := updateBeforeLock(m, rLock, ctx.Done() != nil)
+
+	a := watchdogWait(m, rLock)
+	err := acquireContext(ctx, m, rLock)
+	if r != nil {
+		r.stopWaiting()
+	}
+	if err != nil {
+		// reset the detector data and report potential deadlocks, in which
+		// the acquisition is involved
+		watchdogCancel(a)
+		updateCanceledLock(m)
+		reportLockTimeout(m)
+		return err
+	}
+	watchdogGranted(a)
+
+	atomic.AddInt32(m.getNumberLocked(), 1)
+	return nil
+}
+
+// acquire the underlying mutex or rw-mutex of m, unless ctx is done before.
+// Because sync.Mutex can not be canceled, the lock is tried repeatedly with
+// an increasing delay.
+//  Args:
+//   ctx (context.Context): context of the acquisition
+//   m (mutexInt): mutex or rw-mutex to lock
+//   rLock (bool): if set to true, the lock is a reader lock
+//  Returns:
+//   (error): nil if the lock was acquired, the error of ctx otherwise
+func acquireContext(ctx context.Context, m mutexInt, rLock bool) error {
+	delay := 10 * time.Microsecond
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		if tryAcquire(m, rLock) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		// increase the delay up to 10ms
+		if delay < 10*time.Millisecond {
+			delay *= 2
+		}
+		timer.Reset(delay)
+	}
+}
+
+// reset the detector data for a lock acquisition, which was canceled. The
+// dependency created by the acquisition is kept, because the routine tried
+// to acquire m while holding its locks.
+//  Args:
+//   m (mutexInt): mutex or rw-mutex which was not acquired
+//  Returns:
+//   nil
+func updateCanceledLock(m mutexInt) {
+	// return if detection is disabled
+	if !opts.periodicDetection && !opts.comprehensiveDetection {
+		return
+	}
+
+	// return if the routine is not tracked
+	index := getRoutineIndex()
+	if index == -1 {
+		return
+	}
+
+	m.getIsLockedRoutineIndexLock().Lock()
+	(*m.getIsLockedRoutineIndex())[index] -= 1
+	m.getIsLockedRoutineIndexLock().Unlock()
+
+	getRoutine(index).updateUnlock(m)
 }
 
 // try to lock the mutex or rw-mutex and update the detector data.
@@ -148,114 +299,307 @@ func lockInt(m mutexInt, rLock bool) {
 func tryLockInt(m mutexInt, rLock bool) bool {
 	// do only the operation if detection is completely deactivated
 	if !opts.activated {
-		d, l, t := m.getLock()
-		var res bool
-		if d {
-			// lock if m is mutex
-			res = l.TryLock()
-		} else {
-			// lock if m is rw-mutex
-			if rLock {
-				res = t.TryRLock()
-			} else {
-				res = t.TryLock()
-			}
-		}
-		return res
-	}
-
-	// panic if the lock was not initialized
-	if !*m.getIn() {
-		errorMessage := fmt.Sprint("Lock ", &m, " was not created. Use ",
-			"x := NewLock()")
-		panic(errorMessage)
+		return tryAcquire(m, rLock)
 	}
 
 	// try to lock mu
-	d, l, t := m.getLock()
-	var res bool
-	if d {
-		// lock if m is mutex
-		res = l.TryLock()
-	} else {
-		// lock if m is rw-mutex
-		if rLock {
-			res = t.TryRLock()
-		} else {
-			res = t.TryLock()
-		}
+	if !tryAcquire(m, rLock) {
+		return false
 	}
 
 	// if locking was successful increase numberLocked
-	var index int
-	if res {
-		// initialize routine if necessary
-		index := getRoutineIndex()
-		if index == -1 {
-			// create new routine, if not initialized
-			newRoutine()
-		}
-		index = getRoutineIndex()
-
-		*m.getNumberLocked() += 1
-		m.getIsLockedRoutineIndexLock().Lock()
-		(*m.getIsLockedRoutineIndex())[index] += 1
-		m.getIsLockedRoutineIndexLock().Unlock()
-	}
+	atomic.AddInt32(m.getNumberLocked(), 1)
+	watchdogGranted(watchdogWait(m, rLock))
 
 	// return if detection is disabled
 	if !opts.periodicDetection && !opts.comprehensiveDetection {
-		return res
+		return true
 	}
 
-	// update data structures if more than on routine is running and locking
-	// was successful
+	// initialize routine if necessary
+	index := getRoutineIndex()
+	if index == -1 {
+		// create new routine, if not initialized
+		newRoutine()
+	}
+	index = getRoutineIndex()
+
+	// the routine is not tracked if the maximum number of routines is reached
+	if index == -1 {
+		return true
+	}
+
+	m.getIsLockedRoutineIndexLock().Lock()
+	(*m.getIsLockedRoutineIndex())[index] += 1
+	m.getIsLockedRoutineIndexLock().Unlock()
+
+	// update data structures if more than on routine is running
 	if runtime.NumGoroutine() > 1 {
-		if res {
-			r := &routines[index]
-			(*r).updateTryLock(m, rLock)
-		}
+		getRoutine(index).updateTryLock(m, rLock)
 	}
 
-	return res
+	return true
+}
+
+// try to acquire the underlying mutex or rw-mutex of m
+//  Args:
+//   m (mutexInt): mutex or rw-mutex to lock
+//   rLock (bool): if set to true, the lock is a reader lock
+//  Returns:
+//   (bool): true if the acquisition was successful, false otherwise
+func tryAcquire(m mutexInt, rLock bool) bool {
+	d, l, t := m.getLock()
+	if d {
+		// lock if m is mutex
+		return l.TryLock()
+	}
+
+	// lock if m is rw-mutex
+	if rLock {
+		return t.TryRLock()
+	}
+	return t.TryLock()
 }
 
-// unlock the mutex or rw-mutex and update the detector data
+// unlock the mutex or rw-mutex and update the detector data. If m is released
+// by another routine than the one which acquired it, the detector data of the
+// acquiring routine is updated. If unlock diagnostics are enabled, unlocks of
+// unlocked locks, unlocks by other routines and unlocks which do not match the
+// kind of the acquisition are reported.
 //  Args:
 //   m (mutexInt): mutex or RWMutex to unlock
+//   rLock (bool): true if m is released as reader lock
 //  Returns:
 //   nil
-func unlockInt(m mutexInt) {
-	// panic if the lock was not initialized
-	if !*m.getIn() {
-		errorMessage := fmt.Sprint("Lock ", &m, " was not created. Use ",
-			"x := NewLock()")
-		panic(errorMessage)
+func unlockInt(m mutexInt, rLock bool) {
+	// get the position of the unlock call for the diagnostics
+	var unlock callerInfo
+	if opts.unlockDiagnostics {
+		_, file, line, _ := runtime.Caller(2)
+		unlock = newInfo(file, line, false, "")
 	}
 
-	// panic if lock was not locked
-	if *m.getNumberLocked() == 0 {
-		errorMessage := fmt.Sprint("Tried to unLock lock ", &m,
-			" which was not locked.")
-		panic(errorMessage)
+	// update numberLocked and panic if lock was not locked. Releasing the
+	// underlying lock would be a fatal error, therefore the routine panics
+	// independent of the deadlock response
+	if !decreaseNumberLocked(m) {
+		if !opts.unlockDiagnostics {
+			_, file, line, _ := runtime.Caller(2)
+			unlock = newInfo(file, line, false, "")
+		}
+		report := newReportUnlock(DeadlockUnlockNotLocked, m, -1,
+			callerInfo{}, getRoutineIndex(), unlock)
+		if opts.unlockDiagnostics {
+			printReports([]Report{report})
+		}
+
+		lock := fmt.Sprintf("%#x", m.getMemoryPosition())
+		if name := m.getName(); name != "" {
+			lock = name + " (" + lock + ")"
+		}
+		creation := getCreation(m)
+		panic(&DeadlockError{
+			Type:   DeadlockUnlockNotLocked,
+			Report: report,
+			message: fmt.Sprintf("tried to unlock lock %s created at %s:%d "+
+				"at %s:%d, which was not locked", lock, creation.file,
+				creation.line, unlock.file, unlock.line),
+		})
 	}
 
-	// defer the actual unlocking
-	defer func() {
-		// update numberLocked and isLockedRoutineIndex
-		*m.getNumberLocked() -= 1
-		m.getIsLockedRoutineIndexLock().Lock()
-		(*m.getIsLockedRoutineIndex())[getRoutineIndex()] -= 1
-		m.getIsLockedRoutineIndexLock().Unlock()
-	}()
+	watchdogRelease(m)
 
 	// return if detection is disabled
 	if !opts.periodicDetection && !opts.comprehensiveDetection {
 		return
 	}
 
-	// update data structures if more than on routine is running
+	// find the routine which holds m. Normally this is the calling routine,
+	// but m can also be released by another routine, which may not be tracked
 	index := getRoutineIndex()
-	r := &routines[index]
-	(*r).updateUnlock(m)
+	holder := index
+	if index == -1 || copyLockedRoutineIndex(m)[index] <= 0 {
+		holder = findHolder(m, rLock, index)
+	}
+
+	var r *routine
+	if holder != -1 {
+		r = getRoutine(holder)
+
+		// update isLockedRoutineIndex
+		m.getIsLockedRoutineIndexLock().Lock()
+		(*m.getIsLockedRoutineIndex())[holder] -= 1
+		m.getIsLockedRoutineIndexLock().Unlock()
+	}
+
+	if opts.unlockDiagnostics {
+		var acquisition callerInfo
+		if r != nil {
+			acquisition = r.getHoldingInfo(m)
+		}
+
+		switch {
+		case holder != index:
+			printReports([]Report{newReportUnlock(DeadlockUnlockByOtherRoutine,
+				m, holder, acquisition, index, unlock)})
+		case holder != -1 && m.getRLock(holder) != rLock:
+			printReports([]Report{newReportUnlock(DeadlockUnbalancedUnlock,
+				m, holder, acquisition, index, unlock)})
+		}
+	}
+
+	// update data structures
+	if r != nil {
+		r.updateUnlock(m)
+	}
+}
+
+// decrease numberLocked of m, if it is positive. The check and the decrease
+// are one atomic operation, so that only one of two concurrent unlocks of a
+// lock, which is locked once, succeeds
+//  Args:
+//   m (mutexInt): lock which is released
+//  Returns:
+//   (bool): true if numberLocked was decreased, false if m was not locked
+func decreaseNumberLocked(m mutexInt) bool {
+	for {
+		n := atomic.LoadInt32(m.getNumberLocked())
+		if n <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(m.getNumberLocked(), n, n-1) {
+			return true
+		}
+	}
+}
+
+// find a routine other than the routine with index except, which holds m.
+// A routine which holds m with the same kind (reader or writer) as rLock is
+// preferred. Routines which are still waiting for m are ignored.
+//  Args:
+//   m (mutexInt): lock which is released
+//   rLock (bool): true if m is released as reader lock
+//   except (int): index of the releasing routine
+//  Returns:
+//   (int): index of the holding routine, -1 if no holding routine is known
+func findHolder(m mutexInt, rLock bool, except int) int {
+	holder := -1
+	for index, count := range copyLockedRoutineIndex(m) {
+		if index == except || count <= 0 {
+			continue
+		}
+
+		// the routine is still waiting for m and does not hold it
+		if w, _, _, _ := getRoutine(index).getWaiting(); w == m && count == 1 {
+			continue
+		}
+
+		if m.getRLock(index) == rLock {
+			return index
+		}
+		holder = index
+	}
+	return holder
+}
+
+// get a copy of the number of acquisitions of m by routine index. The copy
+// can be used without holding isLockedRoutineIndexLock of m.
+//  Args:
+//   m (mutexInt): lock to get the acquisitions for
+//  Returns:
+//   (map[int]int): number of acquisitions of m by routine index
+func copyLockedRoutineIndex(m mutexInt) map[int]int {
+	m.getIsLockedRoutineIndexLock().Lock()
+	defer m.getIsLockedRoutineIndexLock().Unlock()
+
+	counts := make(map[int]int, len(*m.getIsLockedRoutineIndex()))
+	for index, count := range *m.getIsLockedRoutineIndex() {
+		counts[index] = count
+	}
+	return counts
+}
+
+// add the caller information info to the context of m
+//  Args:
+//   m (mutexInt): lock or resource
+//   info (callerInfo): info about an acquisition or usage of m
+//  Returns:
+//   nil
+func addContext(m mutexInt, info callerInfo) {
+	m.getContextLock().Lock()
+	defer m.getContextLock().Unlock()
+
+	*m.getContext() = append(*m.getContext(), info)
+}
+
+// get a copy of the context of m. The first element is the creation of m
+//  Args:
+//   m (mutexInt): lock or resource
+//  Returns:
+//   ([]callerInfo): the context of m
+func copyContext(m mutexInt) []callerInfo {
+	m.getContextLock().Lock()
+	defer m.getContextLock().Unlock()
+
+	return append([]callerInfo(nil), *m.getContext()...)
+}
+
+// get the position of the creation of m
+//  Args:
+//   m (mutexInt): lock or resource
+//  Returns:
+//   (callerInfo): info about the creation of m
+func getCreation(m mutexInt) callerInfo {
+	m.getContextLock().Lock()
+	defer m.getContextLock().Unlock()
+
+	return (*m.getContext())[0]
+}
+
+// ids of the lock classes
+var classIds = make(map[string]uintptr)
+
+// lock to prevent concurrent access to classIds
+var classIdsLock sync.Mutex
+
+// get the key which identifies the lock m in the lock trees and lock-order
+// graphs. If lock classes are disabled, this is the memory position of m.
+// Otherwise all locks with the same class share one key.
+//  Args:
+//   m (mutexInt): lock to get the key for
+//  Returns:
+//   (uintptr): the key of the lock
+func lockKey(m mutexInt) uintptr {
+	if !opts.lockClasses {
+		return m.getMemoryPosition()
+	}
+
+	class := lockClass(m)
+
+	classIdsLock.Lock()
+	defer classIdsLock.Unlock()
+	id, ok := classIds[class]
+	if !ok {
+		id = uintptr(len(classIds) + 1)
+		classIds[class] = id
+	}
+	return id
+}
+
+// get the class of the lock m. This is the class set with SetClass or, if
+// no class was set, the name of the lock or, if no name was set, the position
+// where the lock was created
+//  Args:
+//   m (mutexInt): lock to get the class for
+//  Returns:
+//   (string): the class of the lock
+func lockClass(m mutexInt) string {
+	if class := m.getClass(); class != "" {
+		return class
+	}
+	if name := m.getName(); name != "" {
+		return name
+	}
+	creation := getCreation(m)
+	return fmt.Sprintf("%s:%d", creation.file, creation.line)
 }
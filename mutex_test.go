@@ -0,0 +1,45 @@
+package deadlock
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMutexConcurrentDoubleUnlock(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		m := NewLock()
+		m.Lock()
+
+		// exactly one of two concurrent unlocks must panic
+		var wg sync.WaitGroup
+		var panicsLock sync.Mutex
+		var panics []interface{}
+		start := make(chan struct{})
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					if err := recover(); err != nil {
+						panicsLock.Lock()
+						panics = append(panics, err)
+						panicsLock.Unlock()
+					}
+				}()
+				<-start
+				m.Unlock()
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if len(panics) != 1 {
+			t.Fatalf("got %d panics, want 1", len(panics))
+		}
+		err, ok := panics[0].(*DeadlockError)
+		if !ok || err.Type != DeadlockUnlockNotLocked {
+			t.Fatalf("got panic %v, want DeadlockError of type %s", panics[0],
+				DeadlockUnlockNotLocked)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+online.go
+This file implements the online detection of lock order inversions. Similar
+to lockdep in the Linux kernel, a global lock-order graph is maintained.
+Each time a routine creates a new dependency, the edges from the locks in the
+holding set to the acquired lock are added to the graph. Before an edge is
+added, it is checked whether the graph already contains a path in the
+opposite direction. In this case, the new edge closes a cycle and the lock
+order inversion is reported immediately. This allows the detection of
+potential deadlocks in programs which never terminate.
+*/
+
+import "sync"
+
+// edge in the global lock-order graph
+type onlineEdge struct {
+	// lock which was held
+	from mutexInt
+	// lock which was acquired while from was held
+	to mutexInt
+	// true if from was held as reader lock
+	fromRLock bool
+	// true if to was acquired as reader lock
+	toRLock bool
+	// index of the routine which created the edge
+	routine int
+	// info about the acquisition of to, including the call stack
+	caller callerInfo
+}
+
+// global lock-order graph, maps the lock of an edge to the acquired lock of
+// the edge to the edge
+var onlineGraph = make(map[uintptr]map[uintptr]*onlineEdge)
+
+// lock to prevent concurrent access to onlineGraph
+var onlineGraphLock sync.Mutex
+
+// add the edges created by locking m to the global lock-order graph and
+// report lock order inversions
+//  Args:
+//   r (*routine): routine which acquires m
+//   hs ([]mutexInt): locks held by r while m is acquired
+//   hsRLocks ([]bool): true for the locks in hs which are held as reader lock
+//   m (mutexInt): lock which is acquired
+//   rLock (bool): true if m is acquired as reader lock
+//   caller (callerInfo): info about the acquisition of m
+//  Returns:
+//   nil
+func addOnlineEdges(r *routine, hs []mutexInt, hsRLocks []bool, m mutexInt,
+	rLock bool, caller callerInfo) {
+	var reports []Report
+
+	onlineGraphLock.Lock()
+	for i, h := range hs {
+		from := lockKey(h)
+		to := lockKey(m)
+
+		// locking a lock while holding the same lock (or a lock of the same
+		// class) does not create an edge
+		if from == to {
+			continue
+		}
+
+		// the edge already exists
+		if _, ok := onlineGraph[from][to]; ok {
+			continue
+		}
+
+		e := &onlineEdge{
+			from:      h,
+			to:        m,
+			fromRLock: hsRLocks[i],
+			toRLock:   rLock,
+			routine:   r.index,
+			caller:    caller,
+		}
+
+		// search for a path from m to h, which would create a cycle
+		visited := make(map[onlineVisit]struct{})
+		if path := findOnlinePath(to, e.toRLock, from, e.fromRLock, visited); path != nil {
+			reports = append(reports, newReportLockOrderInversion(append([]*onlineEdge{e}, path...)))
+		}
+
+		if onlineGraph[from] == nil {
+			onlineGraph[from] = make(map[uintptr]*onlineEdge)
+		}
+		onlineGraph[from][to] = e
+	}
+	onlineGraphLock.Unlock()
+
+	if len(reports) != 0 {
+		printReports(reports)
+	}
+}
+
+// state of the search for a path in the lock-order graph
+type onlineVisit struct {
+	// current lock
+	lock uintptr
+	// true if the current lock was reached by an edge, where it was acquired
+	// as reader lock
+	rLock bool
+}
+
+// findOnlinePath searches for a path from the lock cur to the lock target in
+// the lock-order graph using depth-first search. Two consecutive edges, where
+// the lock between them is held as reader lock by both edges, do not form a
+// path, because reader locks do not block each other.
+//  Args:
+//   cur (uintptr): key of the current lock
+//   curRLock (bool): true if cur was reached as reader lock
+//   target (uintptr): key of the lock at the end of the path
+//   targetRLock (bool): true if target is held as reader lock after the path
+//   visited (map[onlineVisit]struct{}): already visited states
+//  Returns:
+//   ([]*onlineEdge): edges of the path, nil if no path exists
+func findOnlinePath(cur uintptr, curRLock bool, target uintptr,
+	targetRLock bool, visited map[onlineVisit]struct{}) []*onlineEdge {
+	visited[onlineVisit{lock: cur, rLock: curRLock}] = struct{}{}
+
+	for next, e := range onlineGraph[cur] {
+		// reader locks do not block each other
+		if curRLock && e.fromRLock {
+			continue
+		}
+
+		if next == target {
+			if !(e.toRLock && targetRLock) {
+				return []*onlineEdge{e}
+			}
+			continue
+		}
+
+		if _, ok := visited[onlineVisit{lock: next, rLock: e.toRLock}]; ok {
+			continue
+		}
+
+		if path := findOnlinePath(next, e.toRLock, target, targetRLock, visited); path != nil {
+			return append([]*onlineEdge{e}, path...)
+		}
+	}
+
+	return nil
+}
+
+// newReportLockOrderInversion creates the report for a lock order inversion
+//  Args:
+//   cycle ([]*onlineEdge): edges which form the cycle, starting with the
+//    new edge
+//  Returns:
+//   (Report): the created report
+func newReportLockOrderInversion(cycle []*onlineEdge) Report {
+	r := Report{
+		Type: DeadlockLockOrderInversion,
+	}
+
+	for _, e := range cycle {
+		creation := getCreation(e.to)
+		lr := LockReport{
+			Creation:     Location{File: creation.file, Line: creation.line},
+			Acquisitions: []Location{{File: e.caller.file, Line: e.caller.line}},
+			Routine:      e.routine,
+			Name:         e.to.getName(),
+		}
+		if opts.lockClasses {
+			lr.Class = lockClass(e.to)
+		}
+		if e.caller.callStacks != "" {
+			lr.CallStacks = []string{e.caller.callStacks}
+		}
+		r.Locks = append(r.Locks, lr)
+	}
+
+	return r
+}
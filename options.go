@@ -27,10 +27,48 @@ Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
 options.go
 This file implements options for the deadlock detections such as the
 enabling or disabling of the periodical and/or comprehensive detection as
-well as the periodical detection time and max values for the detection.
+well as the periodical detection time and max values for the detection and
+the reaction of the detector to detected deadlocks.
 */
 
-import "time"
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// DeadlockResponse defines how the detector reacts, if it detects an actual
+// deadlock (double locking or a local deadlock found by the periodical
+// detection)
+type DeadlockResponse int
+
+const (
+	// ResponseExit runs the comprehensive detection and terminates the program
+	// with exit code 2
+	ResponseExit DeadlockResponse = iota
+	// ResponsePanic panics with a *DeadlockError in the routine, in which the
+	// deadlock was detected (double locking). Local deadlocks found by the
+	// periodical detection are only reported, because the panic would happen
+	// in the routine of the detector, where it can not be recovered
+	ResponsePanic
+	// ResponseCallback calls the function set with SetDeadlockCallback
+	ResponseCallback
+	// ResponseContinue only reports the deadlock and lets the program continue
+	ResponseContinue
+)
+
+// OutputFormat defines the format in which found deadlocks are reported
+type OutputFormat int
+
+const (
+	// FormatText prints readable text
+	FormatText OutputFormat = iota
+	// FormatJSON prints the reports as JSON, one report per line
+	FormatJSON
+	// FormatSARIF prints the reports as one SARIF 2.1.0 log, when
+	// FindPotentialDeadlocks or FlushReports is called
+	FormatSARIF
+)
 
 // opts controls how the detection behaves
 var opts = struct {
@@ -61,6 +99,31 @@ var opts = struct {
 	maxRoutines int
 	// The maximum byte size for callStacks
 	maxCallStackSize int
+	// reaction of the detector if an actual deadlock was detected
+	deadlockResponse DeadlockResponse
+	// function called if deadlockResponse is ResponseCallback
+	deadlockCallback func(err *DeadlockError)
+	// format in which the reports are printed
+	outputFormat OutputFormat
+	// writer to which the reports are written
+	output io.Writer
+	// if color is false, reports are never colored
+	color bool
+	// If onlineDetection is set to true, each new dependency is checked for
+	// lock order inversions when it is created
+	onlineDetection bool
+	// If lockClasses is set to true, all locks with the same class share one
+	// node in the lock trees
+	lockClasses bool
+	// If holdTimeThreshold is greater than 0, the watchdog reports locks which
+	// are held longer than holdTimeThreshold
+	holdTimeThreshold time.Duration
+	// If waitTimeThreshold is greater than 0, the watchdog reports lock
+	// acquisitions which wait longer than waitTimeThreshold
+	waitTimeThreshold time.Duration
+	// If unlockDiagnostics is set to true, unlocks of unlocked locks, unlocks
+	// by other routines and unbalanced unlocks of rw-locks are reported
+	unlockDiagnostics bool
 }{
 	activated:                   true,
 	periodicDetection:           true,
@@ -73,6 +136,16 @@ var opts = struct {
 	maxNumberOfDependentLocks:   128,
 	maxRoutines:                 1024,
 	maxCallStackSize:            2048,
+	deadlockResponse:            ResponseExit,
+	deadlockCallback:            nil,
+	outputFormat:                FormatText,
+	output:                      os.Stderr,
+	color:                       true,
+	onlineDetection:             false,
+	lockClasses:                 false,
+	holdTimeThreshold:           0,
+	waitTimeThreshold:           0,
+	unlockDiagnostics:           false,
 }
 
 // Enable or disable all detections
@@ -82,7 +155,7 @@ var opts = struct {
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetActivated(enable bool) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.activated = enable
@@ -99,7 +172,7 @@ func SetActivated(enable bool) bool {
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetPeriodicDetection(enable bool) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.periodicDetection = enable
@@ -114,7 +187,7 @@ func SetPeriodicDetection(enable bool) bool {
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetComprehensiveDetection(enable bool) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.comprehensiveDetection = enable
@@ -129,7 +202,7 @@ func SetComprehensiveDetection(enable bool) bool {
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetPeriodicDetectionTime(seconds int) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.periodicDetectionTime = time.Second * time.Duration(seconds)
@@ -144,7 +217,7 @@ func SetPeriodicDetectionTime(seconds int) bool {
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetCollectCallStack(enable bool) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.collectCallStack = enable
@@ -159,7 +232,7 @@ func SetCollectCallStack(enable bool) bool {
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetCollectSingleLevelLockInformation(enable bool) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.collectSingleLevelLockStack = enable
@@ -173,7 +246,7 @@ func SetCollectSingleLevelLockInformation(enable bool) bool {
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetDoubleLockingDetection(enable bool) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.checkDoubleLocking = enable
@@ -181,62 +254,230 @@ func SetDoubleLockingDetection(enable bool) bool {
 	return true
 }
 
-// Set the max number of dependencies
+// Enable or disable the online detection of lock order inversions
+// If it is enabled, a global lock-order graph is maintained and each new
+// dependency is checked immediately, whether it closes a cycle in this graph
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   enable (bool): true to enable, false to disable
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetOnlineDetection(enable bool) bool {
+	if isInitialized() {
+		return false
+	}
+	opts.onlineDetection = enable
+	return true
+}
+
+// Enable or disable lock classes
+// If it is enabled, all locks which were created at the same position in the
+// code or which have the same class set with SetClass are treated as the same
+// lock in the detection of cyclic locking. This finds ordering problems
+// between different instances of the same type. The detection of double
+// locking still works on single locks.
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   enable (bool): true to enable, false to disable
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetLockClasses(enable bool) bool {
+	if isInitialized() {
+		return false
+	}
+	opts.lockClasses = enable
+	return true
+}
+
+// Set the threshold for the hold time of locks
+// If it is greater than 0, the watchdog reports each lock which is held longer
+// than the threshold. The hold times are checked in the interval of the
+// periodical detection
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   threshold (time.Duration): maximum hold time, 0 to disable
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetHoldTimeThreshold(threshold time.Duration) bool {
+	if isInitialized() {
+		return false
+	}
+	opts.holdTimeThreshold = threshold
+	return true
+}
+
+// Set the threshold for the wait time of lock acquisitions
+// If it is greater than 0, the watchdog reports each lock acquisition which
+// waits longer than the threshold. The wait times are checked in the interval
+// of the periodical detection
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   threshold (time.Duration): maximum wait time, 0 to disable
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetWaitTimeThreshold(threshold time.Duration) bool {
+	if isInitialized() {
+		return false
+	}
+	opts.waitTimeThreshold = threshold
+	return true
+}
+
+// Enable or disable unlock diagnostics
+// If it is enabled, the unlock of a lock which is not locked, the unlock of a
+// lock by another routine than the one which acquired it and the RUnlock of a
+// write lock or Unlock of a read lock are reported with the position of the
+// acquisition and the unlock
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   enable (bool): true to enable, false to disable
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetUnlockDiagnostics(enable bool) bool {
+	if isInitialized() {
+		return false
+	}
+	opts.unlockDiagnostics = enable
+	return true
+}
+
+// Set the max number of dependencies per routine. If the maximum is
+// exceeded, the oldest dependencies of the routine are removed. The
+// dependencies kept from terminated routines are limited by the same maximum
 // It is not possible to set options after the detector was initialized
 //  Args:
 //   number (int): max number of dependencies
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetMaxDependencies(number int) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.maxDependencies = number
 	return true
 }
 
-// Set the max number of locks a lock can depend on
+// Set the max number of locks a lock can depend on. If a routine holds more
+// locks, only the last acquired locks are used for the dependency
 // It is not possible to set options after the detector was initialized
 //  Args:
 //   number (int): max number of locks a lock can depend on
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetMaxNumberOfDependentLocks(number int) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.maxNumberOfDependentLocks = number
 	return true
 }
 
-// Set the max number of routines
+// Set the max number of routines. Locks in additional routines are not
+// considered by the detection
 // It is not possible to set options after the detector was initialized
 //  Args:
 //   number (int): max number of routines
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetMaxRoutines(number int) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.maxRoutines = number
 	return true
 }
 
-// Set the max size of collected call stacks
+// Set the max size of collected call stacks. Longer call stacks are truncated
 // It is not possible to set options after the detector was initialized
 //  Args:
 //   number (int): max size of the call stack in bytes
 //  Returns:
 //   (bool): true, if the set was successful, false otherwise
 func SetMaxCallStackSize(number int) bool {
-	if initialized {
+	if isInitialized() {
 		return false
 	}
 	opts.maxCallStackSize = number
 	return true
 }
 
+// Set how the detector reacts, if an actual deadlock is detected
+// ResponseCallback can only be set with SetDeadlockCallback
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   response (DeadlockResponse): reaction of the detector
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetDeadlockResponse(response DeadlockResponse) bool {
+	if isInitialized() || response == ResponseCallback {
+		return false
+	}
+	opts.deadlockResponse = response
+	return true
+}
+
+// Set a function which is called if an actual deadlock is detected
+// This sets the deadlock response to ResponseCallback
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   callback (func(*DeadlockError)): function called with the detected deadlock
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetDeadlockCallback(callback func(err *DeadlockError)) bool {
+	if isInitialized() || callback == nil {
+		return false
+	}
+	opts.deadlockResponse = ResponseCallback
+	opts.deadlockCallback = callback
+	return true
+}
+
+// Set the format in which found deadlocks are reported. FormatJSON prints
+// each report as one line of JSON, FormatSARIF collects the reports and prints
+// them as one SARIF log, when FindPotentialDeadlocks or FlushReports is called
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   format (OutputFormat): FormatText, FormatJSON or FormatSARIF
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetOutputFormat(format OutputFormat) bool {
+	if isInitialized() {
+		return false
+	}
+	opts.outputFormat = format
+	return true
+}
+
+// Set the writer to which the reports are written
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   w (io.Writer): writer for the reports
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetOutput(w io.Writer) bool {
+	if isInitialized() || w == nil {
+		return false
+	}
+	opts.output = w
+	return true
+}
+
+// Enable or disable colors in the reports
+// Even if colors are enabled, they are only used if the output is a terminal
+// and the environment variable NO_COLOR is not set
+// It is not possible to set options after the detector was initialized
+//  Args:
+//   enable (bool): true to enable, false to disable
+//  Returns:
+//   (bool): true, if the set was successful, false otherwise
+func SetColor(enable bool) bool {
+	if isInitialized() {
+		return false
+	}
+	opts.color = enable
+	return true
+}
+
 // automatically set activated according to the other options
 //  Returns:
 //   nil
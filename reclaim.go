@@ -0,0 +1,271 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+reclaim.go
+This file implements the reclaiming of the slots of terminated routines.
+Programs which create a new routine for each task (e.g. servers with one
+routine per request) would otherwise exceed the maximum number of routines.
+The terminated routines are found by comparing the routines in mapIndex with
+the routines which are still alive. The unique dependencies of a terminated
+routine are moved into a list of retired routines, which is still used by the
+comprehensive detection, and its slot in routines is reused for new routines.
+*/
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// indices of slots in routines which can be reused
+var freeRoutineIndices []int
+
+// routines which have terminated, containing only the dependencies which
+// were not already contained in another retired routine
+var retiredRoutines []routine
+
+// dependency strings of the dependencies in retiredRoutines
+var retiredDependencies = make(map[string]struct{})
+
+// number of dependencies in retiredRoutines. It is limited by
+// opts.maxDependencies
+var retiredDepCount = 0
+
+// internal ids of the routines, which are not tracked, because the maximum
+// number of routines was reached when they were created. Their locks are not
+// considered by the detection
+var untrackedRoutines sync.Map
+
+// minimum time between two reclamations started by the creation of a routine.
+// The reclamation stops the world, so it must not run for each lock operation
+// of untracked routines
+const minReclaimInterval = 100 * time.Millisecond
+
+// time of the last reclamation, protected by createRoutineLock
+var lastReclaim time.Time
+
+// reclaim the slots of all terminated routines.
+// The call stacks of all routines are collected without holding
+// createRoutineLock, because runtime.Stack stops the world while it collects
+// them. Only routines which were registered before the collection can
+// therefore be retired. The leaks of the retired routines are printed after
+// createRoutineLock is released.
+//  Returns:
+//   nil
+func reclaimRoutines() {
+	createRoutineLock.Lock()
+	if len(mapIndex) == 0 {
+		createRoutineLock.Unlock()
+		return
+	}
+	registrations := routineRegistrations
+	lastReclaim = time.Now()
+	createRoutineLock.Unlock()
+
+	alive := getAliveRoutineIds()
+
+	// forget the untracked routines which have terminated
+	untrackedRoutines.Range(func(id, _ interface{}) bool {
+		if _, ok := alive[id.(int64)]; !ok {
+			untrackedRoutines.Delete(id)
+		}
+		return true
+	})
+
+	var reports []Report
+	createRoutineLock.Lock()
+	for id, index := range mapIndex {
+		// routines registered after the collection may be missing in alive
+		if routines[index].registration > registrations {
+			continue
+		}
+		if _, ok := alive[id]; !ok {
+			if report, ok := retireRoutine(index); ok {
+				reports = append(reports, report)
+			}
+		}
+	}
+	createRoutineLock.Unlock()
+
+	if len(reports) != 0 {
+		printReports(reports)
+	}
+}
+
+// move the unique dependencies of a terminated routine into retiredRoutines
+// and free its slot.
+// createRoutineLock must be held by the caller.
+//  Args:
+//   index (int): index of the routine in routines
+//  Returns:
+//   (Report): report of the locks the routine held when it terminated
+//   (bool): true if the routine held locks which were not reported before
+func retireRoutine(index int) (Report, bool) {
+	r := routines[index]
+
+	// the routine has terminated, but its last changes must be visible
+	r.lock.Lock()
+
+	// keep only the dependencies which are not already retired
+	retired := routine{
+		index: index,
+		id:    r.id,
+	}
+	var dependencyString string
+	for i := 0; i < r.depCount; i++ {
+		dep := r.dependencies[i]
+		getDependencyString(&dependencyString, dep)
+		if _, ok := retiredDependencies[dependencyString]; ok {
+			continue
+		}
+		retiredDependencies[dependencyString] = struct{}{}
+		retired.dependencies = append(retired.dependencies, dep)
+		retired.depCount++
+	}
+	if retired.depCount != 0 {
+		retiredRoutines = append(retiredRoutines, retired)
+		retiredDepCount += retired.depCount
+	}
+	held := append([]mutexInt(nil), r.holdingSet[:r.holdingCount]...)
+	r.lock.Unlock()
+
+	// remove the oldest retired dependencies if the maximum is exceeded
+	if retiredDepCount > opts.maxDependencies {
+		warnOnce(`Number of dependencies of terminated routines is greater than
+max number of dependencies. The oldest of these dependencies are removed.
+Increase the maximum number of dependencies with SetMaxDependencies.`)
+		for retiredDepCount > opts.maxDependencies {
+			removeOldestRetiredDependency()
+		}
+	}
+
+	// create the report of the locks the routine held when it terminated
+	report, ok := newReportLockLeak(r)
+
+	// the routine does not hold its locks anymore. Its reader information is
+	// reset, so that a new routine in the slot does not inherit it
+	for _, m := range held {
+		m.getIsLockedRoutineIndexLock().Lock()
+		delete(*m.getIsLockedRoutineIndex(), index)
+		m.getIsLockedRoutineIndexLock().Unlock()
+		m.setRLock(index, false)
+	}
+
+	// free the slot
+	delete(mapIndex, r.id)
+	routines[index] = &routine{lock: &sync.Mutex{}, index: index}
+	freeRoutineIndices = append(freeRoutineIndices, index)
+
+	return report, ok
+}
+
+// remove the oldest dependency of the retired routines.
+// createRoutineLock must be held by the caller.
+//  Returns:
+//   nil
+func removeOldestRetiredDependency() {
+	r := &retiredRoutines[0]
+	var dependencyString string
+	getDependencyString(&dependencyString, r.dependencies[0])
+	delete(retiredDependencies, dependencyString)
+
+	r.dependencies = r.dependencies[1:]
+	r.depCount--
+	retiredDepCount--
+	if r.depCount == 0 {
+		retiredRoutines[0] = routine{}
+		retiredRoutines = retiredRoutines[1:]
+	}
+}
+
+// get the ids of all routines which are still alive
+//  Returns:
+//   (map[int64]struct{}): set of the internal ids of the alive routines
+func getAliveRoutineIds() map[int64]struct{} {
+	alive := make(map[int64]struct{})
+	for id := range getRoutineStacks() {
+		alive[id] = struct{}{}
+	}
+	return alive
+}
+
+// get the current call stacks of all routines. runtime.Stack stops the world
+// while it collects the stacks, so the function should not be called while
+// holding locks of the detector
+//  Returns:
+//   (map[int64]string): call stacks of the routines by their internal id
+func getRoutineStacks() map[int64]string {
+	// get the stacks of all routines, increase the buffer until all stacks fit
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	// the stacks are separated by empty lines and each stack starts with a
+	// line "goroutine <id> [<state>]:"
+	stacks := make(map[int64]string)
+	prefix := []byte("goroutine ")
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if !bytes.HasPrefix(stack, prefix) {
+			continue
+		}
+		line := stack[len(prefix):]
+		end := bytes.IndexByte(line, ' ')
+		if end == -1 {
+			continue
+		}
+		id, err := strconv.ParseInt(string(line[:end]), 10, 64)
+		if err != nil {
+			continue
+		}
+		stacks[id] = string(stack) + "\n"
+	}
+
+	return stacks
+}
+
+// get all routines for the comprehensive detection. These are snapshots of
+// the routines in routines and the retired routines.
+//  Returns:
+//   ([]routine): the routines
+func getAllRoutines() []routine {
+	createRoutineLock.Lock()
+	defer createRoutineLock.Unlock()
+
+	rs := make([]routine, 0, numberRoutines+len(retiredRoutines))
+	for _, r := range routines {
+		rs = append(rs, r.snapshot())
+	}
+	rs = append(rs, retiredRoutines...)
+	return rs
+}
@@ -1,9 +1,18 @@
 package deadlock
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/petermattis/goid"
 )
 
 /*
@@ -31,8 +40,9 @@ Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
 
 /*
 report.go
-This file contains functions to report deadlock that were found in any of
-the deadlock checks
+This file contains the types to describe deadlocks that were found in any of
+the deadlock checks as well as the functions to create and print these
+reports
 */
 
 // colors for deadlock messages
@@ -42,89 +52,852 @@ const (
 	blue   = "\033[0;36m%s\033[0m"
 )
 
-// report if double locking is detected
+// colorFormat returns the format string to print text in the given color.
+// If colors are disabled, the text is printed without color.
 //  Args:
-//   m (mutexInt): mutex on which double locking was detected
+//   color (string): format string of the color
 //  Returns:
-//   nil
-func reportDeadlockDoubleLocking(m mutexInt) {
-	fmt.Fprintf(os.Stderr, red, "DEADLOCK (DOUBLE LOCKING)\n\n")
+//   (string): format string to print the text with
+func colorFormat(color string) string {
+	if !useColor() {
+		return "%s"
+	}
+	return color
+}
 
-	// print information about the involved lock
-	fmt.Fprintf(os.Stderr, purple, "Initialization of lock involved in deadlock:\n\n")
-	context := *m.getContext()
-	fmt.Fprintln(os.Stderr, context[0].file, context[0].line)
-	fmt.Fprintln(os.Stderr, "")
-	fmt.Fprintf(os.Stderr, purple, "Calls of lock involved in deadlock:\n\n")
-	for i, call := range context {
+// useColor checks whether the reports should be colored. This is the case,
+// if colors are enabled in the options, the environment variable NO_COLOR is
+// not set and the output is a terminal.
+//  Returns:
+//   (bool): true if the reports should be colored, false otherwise
+func useColor() bool {
+	if !opts.color {
+		return false
+	}
+
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	f, ok := opts.output.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Location describes a position in the code
+type Location struct {
+	// name of the file with full path
+	File string `json:"file"`
+	// line in the file
+	Line int `json:"line"`
+}
+
+// LockReport contains the information about a lock involved in a deadlock
+type LockReport struct {
+	// position where the lock was created
+	Creation Location `json:"creation"`
+	// positions where the lock was acquired
+	Acquisitions []Location `json:"acquisitions"`
+	// call stacks of the acquisitions of the lock, only collected if
+	// SetCollectCallStack is enabled
+	CallStacks []string `json:"callStacks,omitempty"`
+	// index of the routine, from which the lock is involved in the deadlock,
+	// -1 if unknown
+	Routine int `json:"routine"`
+	// name of the lock, set with NewLockNamed, NewRWLockNamed or SetName
+	Name string `json:"name,omitempty"`
+	// class of the lock, only set if lock classes are enabled
+	Class string `json:"class,omitempty"`
+	// position where the lock was released, only set for reports of unlock
+	// diagnostics
+	Release *Location `json:"release,omitempty"`
+}
+
+// RoutineReport contains the information about a routine involved in an
+// actual deadlock
+type RoutineReport struct {
+	// index of the routine
+	Routine int `json:"routine"`
+	// internal go id of the routine
+	ID int64 `json:"id"`
+	// call stack of the routine at the time the deadlock was detected
+	Stack string `json:"stack,omitempty"`
+}
+
+// Report describes a deadlock found by the detector
+type Report struct {
+	// kind of the deadlock
+	Type DeadlockType `json:"type"`
+	// locks involved in the deadlock. For cyclic deadlocks the locks are
+	// ordered as they appear in the cycle
+	Locks []LockReport `json:"locks"`
+	// wait or hold time for reports of the watchdog
+	Duration time.Duration `json:"duration,omitempty"`
+	// routines involved in a local deadlock found by the periodical detection,
+	// in the same order as the locks
+	Routines []RoutineReport `json:"routines,omitempty"`
+	// dependencies which form the cycle for cyclic deadlocks
+	cycle []*dependency
+}
+
+// ============ CREATE REPORTS ============
+
+// newLockReport creates the report for a lock
+//  Args:
+//   m (mutexInt): lock for which the report is created
+//   routine (int): index of the routine, from which the lock is involved
+//  Returns:
+//   (LockReport): the report for the lock
+func newLockReport(m mutexInt, routine int) LockReport {
+	lr := LockReport{
+		Routine: routine,
+	}
+
+	lr.Name = m.getName()
+	if opts.lockClasses {
+		lr.Class = lockClass(m)
+	}
+
+	for i, c := range copyContext(m) {
 		if i == 0 {
+			lr.Creation = Location{File: c.file, Line: c.line}
 			continue
 		}
-		fmt.Fprintln(os.Stderr, call.file, call.line)
+		lr.Acquisitions = append(lr.Acquisitions, Location{File: c.file, Line: c.line})
+		if c.callStacks != "" {
+			lr.CallStacks = append(lr.CallStacks, c.callStacks)
+		}
+	}
+
+	return lr
+}
+
+// newReportCycle creates the report for a deadlock represented by a cycle
+// in the lock trees
+//  Args:
+//   deadlockType (DeadlockType): kind of the deadlock
+//   stack (*depStack): stack which represents the found cycle
+//  Returns:
+//   (Report): the created report
+func newReportCycle(deadlockType DeadlockType, stack *depStack) Report {
+	r := Report{
+		Type: deadlockType,
+	}
+
+	for cl := stack.stack.next; cl != nil; cl = cl.next {
+		r.Locks = append(r.Locks, newLockReport(cl.depEntry.mu, cl.index))
+		r.cycle = append(r.cycle, cl.depEntry)
+	}
+
+	return r
+}
+
+// newReportLocal creates the report for a local deadlock found by the
+// periodical detection. Additionally to the locks in the cycle, the report
+// contains the current call stacks of the routines in the cycle
+//  Args:
+//   stack (*depStack): stack which represents the found cycle
+//  Returns:
+//   (Report): the created report
+func newReportLocal(stack *depStack) Report {
+	r := newReportCycle(DeadlockLocal, stack)
+
+	// get the call stacks of all routines and keep the ones in the cycle
+	stacks := getRoutineStacks()
+	for cl := stack.stack.next; cl != nil; cl = cl.next {
+		id := getRoutine(cl.index).id
+		r.Routines = append(r.Routines, RoutineReport{
+			Routine: cl.index,
+			ID:      id,
+			Stack:   stacks[id],
+		})
+	}
+
+	return r
+}
+
+// newReportDoubleLocking creates the report for a double locking.
+// The position of the lock call which would lead to the double locking is
+// added to the acquisitions of the lock
+//  Args:
+//   m (mutexInt): mutex on which double locking was detected
+//   routine (int): index of the routine which tried to lock m
+//  Returns:
+//   (Report): the created report
+func newReportDoubleLocking(m mutexInt, routine int) Report {
+	lr := newLockReport(m, routine)
+	_, file, line, _ := runtime.Caller(5)
+	lr.Acquisitions = append(lr.Acquisitions, Location{File: file, Line: line})
+
+	return Report{
+		Type:  DeadlockDoubleLocking,
+		Locks: []LockReport{lr},
+	}
+}
+
+// newReportRecursiveRLock creates the report for a recursive r-lock of a
+// rw-lock. The acquisitions of the lock are the position, where the lock is
+// already held, and the position of the new r-lock call
+//  Args:
+//   m (mutexInt): rw-mutex which is r-locked recursively
+//   routine (int): index of the routine which tries to r-lock m
+//   held (callerInfo): position of the acquisition of m, which is still held
+//  Returns:
+//   (Report): the created report
+func newReportRecursiveRLock(m mutexInt, routine int, held callerInfo) Report {
+	lr := newLockReport(m, routine)
+	_, file, line, _ := runtime.Caller(5)
+	lr.Acquisitions = []Location{
+		{File: held.file, Line: held.line},
+		{File: file, Line: line},
+	}
+	lr.CallStacks = nil
+
+	return Report{
+		Type:  DeadlockRecursiveRLock,
+		Locks: []LockReport{lr},
+	}
+}
+
+// recursive r-locks which have already been reported
+var reportedRecursiveRLocks = make(map[string]struct{})
+
+// lock to prevent concurrent access to reportedRecursiveRLocks
+var reportedRecursiveRLocksLock sync.Mutex
+
+// print the report of a recursive r-lock, if the same lock was not reported
+// for the same positions before
+//  Args:
+//   r (Report): report of the recursive r-lock
+//  Returns:
+//   nil
+func reportRecursiveRLock(r Report) {
+	lr := r.Locks[0]
+	key := fmt.Sprint(lr.Creation, lr.Acquisitions)
+
+	reportedRecursiveRLocksLock.Lock()
+	_, ok := reportedRecursiveRLocks[key]
+	reportedRecursiveRLocks[key] = struct{}{}
+	reportedRecursiveRLocksLock.Unlock()
+
+	if !ok {
+		printReports([]Report{r})
+	}
+}
+
+// newReportUnlock creates the report of the unlock diagnostics. The
+// acquisitions of the lock only contain the acquisition, which is released,
+// if it is known
+//  Args:
+//   t (DeadlockType): kind of the diagnostic
+//   m (mutexInt): released lock
+//   holder (int): index of the routine which acquired m, -1 if unknown
+//   acquisition (callerInfo): position of the acquisition of m, empty if unknown
+//   releaser (int): index of the routine which releases m, -1 if unknown
+//   unlock (callerInfo): position of the unlock call
+//  Returns:
+//   (Report): the created report
+func newReportUnlock(t DeadlockType, m mutexInt, holder int,
+	acquisition callerInfo, releaser int, unlock callerInfo) Report {
+	lr := newLockReport(m, holder)
+	lr.Acquisitions = nil
+	lr.CallStacks = nil
+	if acquisition.file != "" {
+		lr.Acquisitions = []Location{{File: acquisition.file, Line: acquisition.line}}
+	}
+	lr.Release = &Location{File: unlock.file, Line: unlock.line}
+
+	r := Report{
+		Type:  t,
+		Locks: []LockReport{lr},
+	}
+	if releaser != -1 {
+		r.Routines = []RoutineReport{{Routine: releaser, ID: goid.Get()}}
+	}
+	return r
+}
+
+// newReportTimeout creates the report for a potential deadlock, in which a
+// canceled acquisition of m is involved. The cycle is rotated, so that the
+// dependency of m is the first element, and the position of the canceled
+// lock call is added to the acquisitions of m
+//  Args:
+//   cycle (Report): report of the potential deadlock
+//   m (mutexInt): mutex which could not be acquired
+//  Returns:
+//   (Report): the created report
+func newReportTimeout(cycle Report, m mutexInt) Report {
+	r := Report{
+		Type: DeadlockTimeout,
+	}
+
+	// find the dependency of m in the cycle
+	start := 0
+	for i, dep := range cycle.cycle {
+		if lockKey(dep.mu) == lockKey(m) {
+			start = i
+			break
+		}
+	}
+
+	// rotate the cycle
+	n := len(cycle.cycle)
+	for i := 0; i < n; i++ {
+		r.Locks = append(r.Locks, cycle.Locks[(start+i)%n])
+		r.cycle = append(r.cycle, cycle.cycle[(start+i)%n])
 	}
+
 	_, file, line, _ := runtime.Caller(4)
-	fmt.Fprintln(os.Stderr, file, line)
-	fmt.Fprintf(os.Stderr, "\n\n")
+	r.Locks[0].Acquisitions = append(r.Locks[0].Acquisitions,
+		Location{File: file, Line: line})
+
+	return r
 }
 
-// report a found deadlock
+// number of dependencies added to the lock trees, only accessed atomically
+var dependencyVersion uint64
+
+// value of dependencyVersion at the last search for potential deadlocks after
+// a canceled acquisition, by the key of the lock
+var timeoutSearches = make(map[uintptr]uint64)
+
+// cycles which have already been reported for a canceled acquisition
+var reportedTimeouts = make(map[string]struct{})
+
+// lock to prevent concurrent access to timeoutSearches and reportedTimeouts
+var reportedTimeoutsLock sync.Mutex
+
+// report all potential deadlocks, in which the canceled acquisition of m is
+// involved. The lock trees are only searched again, if a dependency was added
+// since the last search for m, and each cycle is only reported once. This
+// way a retry loop around a canceled acquisition does not repeat the search
+// and the reports.
 //  Args:
-//   stack (*depStack) stack which represents the found cycle
+//   m (mutexInt): mutex which could not be acquired
 //  Returns:
 //   nil
-func reportDeadlock(stack *depStack) {
-	fmt.Fprintf(os.Stderr, red, "POTENTIAL DEADLOCK\n\n")
+func reportLockTimeout(m mutexInt) {
+	if !opts.comprehensiveDetection {
+		return
+	}
 
-	// print information about the locks in the circle
-	fmt.Fprintf(os.Stderr, purple, "Initialization of locks involved in potential deadlock:\n\n")
-	for cl := stack.stack.next; cl != nil; cl = cl.next {
-		for _, c := range *cl.depEntry.mu.getContext() {
-			if c.create {
-				fmt.Fprintln(os.Stderr, c.file, c.line)
+	key := lockKey(m)
+	version := atomic.LoadUint64(&dependencyVersion)
+	reportedTimeoutsLock.Lock()
+	if last, ok := timeoutSearches[key]; ok && last == version {
+		reportedTimeoutsLock.Unlock()
+		return
+	}
+	timeoutSearches[key] = version
+	reportedTimeoutsLock.Unlock()
+
+	var reports []Report
+	for _, cycle := range detect(getAllRoutines()) {
+		for _, dep := range cycle.cycle {
+			if lockKey(dep.mu) == key {
+				if isNewTimeoutCycle(cycle.cycle) {
+					reports = append(reports, newReportTimeout(cycle, m))
+				}
+				break
 			}
 		}
 	}
 
+	if len(reports) != 0 {
+		printReports(reports)
+	}
+}
+
+// check if the cycle was not reported for a canceled acquisition before and
+// remember it. The key of a cycle does not depend on the dependency, with
+// which the cycle starts.
+//  Args:
+//   cycle ([]*dependency): dependencies of the cycle
+//  Returns:
+//   (bool): true if the cycle was not reported before, false otherwise
+func isNewTimeoutCycle(cycle []*dependency) bool {
+	deps := make([]string, len(cycle))
+	for i, dep := range cycle {
+		getDependencyString(&deps[i], dep)
+	}
+	sort.Strings(deps)
+	key := strings.Join(deps, ";")
+
+	reportedTimeoutsLock.Lock()
+	defer reportedTimeoutsLock.Unlock()
+
+	if _, ok := reportedTimeouts[key]; ok {
+		return false
+	}
+	reportedTimeouts[key] = struct{}{}
+	return true
+}
+
+// newAcquisitionReport creates the report for a lock acquisition recorded
+// by the watchdog. The acquisitions only contain the position of the lock call
+// and the call stacks only contain the current call stack of the routine
+//  Args:
+//   a (acquisition): record of the acquisition
+//   stacks (map[int64]string): current call stacks of the routines
+//  Returns:
+//   (LockReport): the report for the acquisition
+func newAcquisitionReport(a acquisition, stacks map[int64]string) LockReport {
+	routine := -1
+	createRoutineLock.Lock()
+	if index, ok := mapIndex[a.id]; ok {
+		routine = index
+	}
+	createRoutineLock.Unlock()
+
+	lr := newLockReport(a.m, routine)
+	lr.Acquisitions = []Location{{File: a.file, Line: a.line}}
+	lr.CallStacks = nil
+	if stack, ok := stacks[a.id]; ok {
+		lr.CallStacks = []string{stack}
+	}
+
+	return lr
+}
+
+// newReportLongWait creates the report for an acquisition, which waits longer
+// than the wait time threshold. The first lock report describes the waiting
+// acquisition, the others the current holders of the lock
+//  Args:
+//   a (*acquisition): record of the waiting acquisition
+//   holders ([]acquisition): records of the current holders of the lock
+//   now (time.Time): time of the check
+//   stacks (map[int64]string): current call stacks of the routines
+//  Returns:
+//   (Report): the created report
+func newReportLongWait(a *acquisition, holders []acquisition, now time.Time,
+	stacks map[int64]string) Report {
+	r := Report{
+		Type:     DeadlockLongWait,
+		Locks:    []LockReport{newAcquisitionReport(*a, stacks)},
+		Duration: now.Sub(a.waitStart),
+	}
+	for _, h := range holders {
+		r.Locks = append(r.Locks, newAcquisitionReport(h, stacks))
+	}
+	return r
+}
+
+// newReportLongHold creates the report for a lock, which is held longer than
+// the hold time threshold
+//  Args:
+//   a (*acquisition): record of the acquisition of the held lock
+//   now (time.Time): time of the check
+//   stacks (map[int64]string): current call stacks of the routines
+//  Returns:
+//   (Report): the created report
+func newReportLongHold(a *acquisition, now time.Time,
+	stacks map[int64]string) Report {
+	return Report{
+		Type:     DeadlockLongHold,
+		Locks:    []LockReport{newAcquisitionReport(*a, stacks)},
+		Duration: now.Sub(a.granted),
+	}
+}
+
+// ============ PRINT REPORTS ============
+
+// get the name and class of a lock in a report as text, which is added to the
+// creation of the lock in the text reports
+//  Args:
+//   lr (LockReport): report of the lock
+//  Returns:
+//   (string): name and class of the lock, empty if both are not set
+func lockAnnotation(lr LockReport) string {
+	switch {
+	case lr.Name != "" && lr.Class != "":
+		return fmt.Sprintf(" (name %s, class %s)", lr.Name, lr.Class)
+	case lr.Name != "":
+		return fmt.Sprintf(" (name %s)", lr.Name)
+	case lr.Class != "":
+		return fmt.Sprintf(" (class %s)", lr.Class)
+	}
+	return ""
+}
+
+// warnings which have already been printed
+var printedWarnings = make(map[string]struct{})
+
+// lock to prevent concurrent access to printedWarnings
+var printedWarningsLock sync.Mutex
+
+// print a warning of the detector, if the same warning has not been printed
+// before. If the reports are printed in a machine-readable format, the warning
+// is written to stderr instead of the output
+//  Args:
+//   message (string): warning to print
+//  Returns:
+//   nil
+func warnOnce(message string) {
+	printedWarningsLock.Lock()
+	defer printedWarningsLock.Unlock()
+
+	if _, ok := printedWarnings[message]; ok {
+		return
+	}
+	printedWarnings[message] = struct{}{}
+
+	// the machine-readable formats must only contain reports
+	if opts.outputFormat != FormatText {
+		fmt.Fprintln(os.Stderr, "DEADLOCK-GO WARNING:", message)
+		return
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, colorFormat(purple), "DEADLOCK-GO WARNING: ")
+	fmt.Fprintln(&buf, message)
+	writeOutput(buf.Bytes())
+}
+
+// print reports in the format set in the options
+//  Args:
+//   reports ([]Report): reports to print
+//  Returns:
+//   nil
+func printReports(reports []Report) {
+	switch opts.outputFormat {
+	case FormatJSON:
+		printReportsJSON(reports)
+	case FormatSARIF:
+		printReportsSARIF(reports)
+	default:
+		// the reports are written with one call of Write, so that they are not
+		// mixed with concurrently printed reports
+		var buf bytes.Buffer
+		for _, r := range reports {
+			printReport(&buf, r)
+		}
+		writeOutput(buf.Bytes())
+	}
+}
+
+// print a report as text
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report to print
+//  Returns:
+//   nil
+func printReport(w io.Writer, r Report) {
+	switch r.Type {
+	case DeadlockPotential:
+		printReportPotential(w, r)
+	case DeadlockDoubleLocking:
+		printReportDoubleLocking(w, r)
+	case DeadlockLocal:
+		printReportPeriodical(w, r)
+	case DeadlockLockOrderInversion:
+		printReportLockOrderInversion(w, r)
+	case DeadlockTimeout:
+		printReportTimeout(w, r)
+	case DeadlockLongWait, DeadlockLongHold:
+		printReportWatchdog(w, r)
+	case DeadlockRecursiveRLock:
+		printReportRecursiveRLock(w, r)
+	case DeadlockUnlockNotLocked, DeadlockUnlockByOtherRoutine,
+		DeadlockUnbalancedUnlock:
+		printReportUnlock(w, r)
+	case DeadlockLockLeak, DeadlockHeldLocks:
+		printReportHeldLocks(w, r)
+	}
+}
+
+// print a report about double locking
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the double locking
+//  Returns:
+//   nil
+func printReportDoubleLocking(w io.Writer, r Report) {
+	fmt.Fprintf(w, colorFormat(red), "DEADLOCK (DOUBLE LOCKING)\n\n")
+
+	// print information about the involved lock
+	lr := r.Locks[0]
+	fmt.Fprintf(w, colorFormat(purple), "Initialization of lock involved in deadlock:\n\n")
+	fmt.Fprintf(w, "%s %d%s\n", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr))
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, colorFormat(purple), "Calls of lock involved in deadlock:\n\n")
+	for _, call := range lr.Acquisitions {
+		fmt.Fprintln(w, call.File, call.Line)
+	}
+	fmt.Fprintf(w, "\n\n")
+}
+
+// print a report about a recursive r-lock
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the recursive r-lock
+//  Returns:
+//   nil
+func printReportRecursiveRLock(w io.Writer, r Report) {
+	fmt.Fprintf(w, colorFormat(red), "POTENTIAL DEADLOCK (RECURSIVE READ LOCKING)\n\n")
+
+	// print information about the involved lock
+	lr := r.Locks[0]
+	fmt.Fprintf(w, colorFormat(purple), "Initialization of lock involved in potential deadlock:\n\n")
+	fmt.Fprintf(w, "%s %d%s\n", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr))
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, colorFormat(purple), "Held read lock:\n\n")
+	fmt.Fprintln(w, lr.Acquisitions[0].File, lr.Acquisitions[0].Line)
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, colorFormat(purple), "Recursive read lock:\n\n")
+	fmt.Fprintln(w, lr.Acquisitions[1].File, lr.Acquisitions[1].Line)
+	fmt.Fprintf(w, "\n\n")
+}
+
+// print a report of the unlock diagnostics
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the unlock
+//  Returns:
+//   nil
+func printReportUnlock(w io.Writer, r Report) {
+	switch r.Type {
+	case DeadlockUnlockNotLocked:
+		fmt.Fprintf(w, colorFormat(red), "UNLOCK OF UNLOCKED LOCK\n\n")
+	case DeadlockUnlockByOtherRoutine:
+		fmt.Fprintf(w, colorFormat(red), "UNLOCK BY OTHER ROUTINE\n\n")
+	default:
+		fmt.Fprintf(w, colorFormat(red), "UNBALANCED UNLOCK\n\n")
+	}
+
+	// print information about the lock
+	lr := r.Locks[0]
+	fmt.Fprintf(w, colorFormat(purple), "Initialization of lock:\n\n")
+	fmt.Fprintf(w, "%s %d%s\n", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr))
+	fmt.Fprintln(w, "")
+
+	// print the acquisition and the release
+	if len(lr.Acquisitions) != 0 {
+		fmt.Fprintf(w, colorFormat(purple), "Acquisition:\n\n")
+		fmt.Fprintf(w, "acquired in routine %d at %s %d\n", lr.Routine,
+			lr.Acquisitions[0].File, lr.Acquisitions[0].Line)
+		fmt.Fprintln(w, "")
+	}
+	fmt.Fprintf(w, colorFormat(purple), "Release:\n\n")
+	if len(r.Routines) != 0 {
+		fmt.Fprintf(w, "released in routine %d at %s %d\n",
+			r.Routines[0].Routine, lr.Release.File, lr.Release.Line)
+	} else {
+		fmt.Fprintf(w, "released at %s %d\n", lr.Release.File, lr.Release.Line)
+	}
+	fmt.Fprintf(w, "\n\n")
+}
+
+// print a report about the locks held by a terminated routine or at the end
+// of the program
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the held locks
+//  Returns:
+//   nil
+func printReportHeldLocks(w io.Writer, r Report) {
+	rr := r.Routines[0]
+	if r.Type == DeadlockLockLeak {
+		fmt.Fprintf(w, colorFormat(red), "LOCK LEAK\n\n")
+		fmt.Fprintf(w, colorFormat(purple), fmt.Sprintf("Routine %d (goroutine %d) terminated while holding locks:\n\n", rr.Routine, rr.ID))
+	} else {
+		fmt.Fprintf(w, colorFormat(red), "LOCKS HELD AT THE END OF THE PROGRAM\n\n")
+		fmt.Fprintf(w, colorFormat(purple), fmt.Sprintf("Locks held by routine %d (goroutine %d):\n\n", rr.Routine, rr.ID))
+	}
+
+	// print the held locks and their acquisitions
+	for _, lr := range r.Locks {
+		fmt.Fprintf(w, colorFormat(blue), fmt.Sprintf("Lock created at: %s:%d%s", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr)))
+		fmt.Fprintf(w, "\n")
+		for _, a := range lr.Acquisitions {
+			fmt.Fprintf(w, "acquired at %s %d\n", a.File, a.Line)
+		}
+		fmt.Fprintln(w, "")
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// print a report about a potential deadlock
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the potential deadlock
+//  Returns:
+//   nil
+func printReportPotential(w io.Writer, r Report) {
+	fmt.Fprintf(w, colorFormat(red), "POTENTIAL DEADLOCK\n\n")
+	printReportLocks(w, r)
+}
+
+// print a report about a potential deadlock, in which a canceled lock
+// acquisition is involved
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the potential deadlock
+//  Returns:
+//   nil
+func printReportTimeout(w io.Writer, r Report) {
+	fmt.Fprintf(w, colorFormat(red), "POTENTIAL DEADLOCK (LOCK TIMEOUT)\n\n")
+
+	// print the canceled acquisition
+	lr := r.Locks[0]
+	call := lr.Acquisitions[len(lr.Acquisitions)-1]
+	fmt.Fprintf(w, colorFormat(purple), "Canceled acquisition:\n\n")
+	fmt.Fprintln(w, call.File, call.Line)
+	fmt.Fprintln(w, "")
+
+	printReportLocks(w, r)
+}
+
+// print the creations and acquisitions of the locks involved in a potential
+// deadlock
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the potential deadlock
+//  Returns:
+//   nil
+func printReportLocks(w io.Writer, r Report) {
+	// print information about the locks in the circle
+	fmt.Fprintf(w, colorFormat(purple), "Initialization of locks involved in potential deadlock:\n\n")
+	for _, lr := range r.Locks {
+		fmt.Fprintf(w, "%s %d%s\n", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr))
+	}
+
 	// print information if call stacks were collected
 	if opts.collectCallStack {
-		fmt.Fprintf(os.Stderr, purple, "\nCallStacks of Locks involved in potential deadlock:\n\n")
-		for cl := stack.stack.next; cl != nil; cl = cl.next {
-			cont := *cl.depEntry.mu.getContext()
-			fmt.Fprintf(os.Stderr, blue, "CallStacks for lock created at: ")
-			fmt.Fprintf(os.Stderr, blue, cont[0].file)
-			fmt.Fprintf(os.Stderr, blue, ":")
-			fmt.Fprintf(os.Stderr, blue, fmt.Sprint(cont[0].line))
-			fmt.Fprintf(os.Stderr, "\n\n")
-			for i, c := range cont {
-				if i != 0 {
-					fmt.Fprint(os.Stderr, c.callStacks)
-				}
+		fmt.Fprintf(w, colorFormat(purple), "\nCallStacks of Locks involved in potential deadlock:\n\n")
+		for _, lr := range r.Locks {
+			fmt.Fprintf(w, colorFormat(blue), "CallStacks for lock created at: ")
+			fmt.Fprintf(w, colorFormat(blue), lr.Creation.File)
+			fmt.Fprintf(w, colorFormat(blue), ":")
+			fmt.Fprintf(w, colorFormat(blue), fmt.Sprint(lr.Creation.Line, lockAnnotation(lr)))
+			fmt.Fprintf(w, "\n\n")
+			for _, c := range lr.CallStacks {
+				fmt.Fprint(w, c)
 			}
 		}
 	} else {
 		// print information if only caller information were selected
-		fmt.Fprintf(os.Stderr, purple, "\nCalls of locks involved in potential deadlock:\n\n")
-		for cl := stack.stack.next; cl != nil; cl = cl.next {
-			for i, c := range *cl.depEntry.mu.getContext() {
-				if i == 0 {
-					fmt.Fprintf(os.Stderr, blue, "Calls for lock created at: ")
-					fmt.Fprintf(os.Stderr, blue, c.file)
-					fmt.Fprintf(os.Stderr, blue, ":")
-					fmt.Fprintf(os.Stderr, blue, fmt.Sprint(c.line))
-					fmt.Fprintf(os.Stderr, "\n")
-				} else {
-					fmt.Fprintln(os.Stderr, c.file, c.line)
-				}
+		fmt.Fprintf(w, colorFormat(purple), "\nCalls of locks involved in potential deadlock:\n\n")
+		for _, lr := range r.Locks {
+			fmt.Fprintf(w, colorFormat(blue), "Calls for lock created at: ")
+			fmt.Fprintf(w, colorFormat(blue), lr.Creation.File)
+			fmt.Fprintf(w, colorFormat(blue), ":")
+			fmt.Fprintf(w, colorFormat(blue), fmt.Sprint(lr.Creation.Line, lockAnnotation(lr)))
+			fmt.Fprintf(w, "\n")
+			for _, c := range lr.Acquisitions {
+				fmt.Fprintln(w, c.File, c.Line)
 			}
-			fmt.Fprintln(os.Stderr, "")
+			fmt.Fprintln(w, "")
 		}
 	}
-	fmt.Fprintf(os.Stderr, "\n\n")
+	fmt.Fprintf(w, "\n\n")
 }
 
-// print a message, that the program was terminated because of a detected local deadlock
-// Returns:
-//  nil
-func reportDeadlockPeriodical() {
-	fmt.Fprintf(os.Stderr, red, "THE PROGRAM WAS TERMINATED BECAUSE IT DETECTED A LOCAL DEADLOCK\n\n")
+// print a report about a local deadlock with the cycle of the involved locks
+// and the call stacks of the involved routines
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the local deadlock
+//  Returns:
+//   nil
+func printReportPeriodical(w io.Writer, r Report) {
+	if opts.deadlockResponse == ResponseExit {
+		fmt.Fprintf(w, colorFormat(red), "THE PROGRAM WAS TERMINATED BECAUSE IT DETECTED A LOCAL DEADLOCK\n\n")
+	} else {
+		fmt.Fprintf(w, colorFormat(red), "DETECTED A LOCAL DEADLOCK\n\n")
+	}
+
+	// print the cycle. The routine of a lock waits for the lock, which is
+	// held by the routine of the next lock in the cycle
+	fmt.Fprintf(w, colorFormat(purple), "Locks involved in deadlock:\n\n")
+	for i, lr := range r.Locks {
+		holder := r.Locks[(i+1)%len(r.Locks)].Routine
+		fmt.Fprintf(w, colorFormat(blue), fmt.Sprintf("Lock created at: %s:%d%s", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr)))
+		fmt.Fprintf(w, "\n")
+		fmt.Fprintf(w, "held by routine %d, waited for by routine %d\n", holder, lr.Routine)
+		for _, a := range lr.Acquisitions {
+			fmt.Fprintln(w, a.File, a.Line)
+		}
+		fmt.Fprintln(w, "")
+	}
+
+	// print the call stacks of the routines in the cycle
+	fmt.Fprintf(w, colorFormat(purple), "\nCallStacks of routines involved in deadlock:\n\n")
+	for _, rr := range r.Routines {
+		fmt.Fprintf(w, colorFormat(blue), fmt.Sprintf("Routine %d (goroutine %d):", rr.Routine, rr.ID))
+		fmt.Fprintf(w, "\n")
+		fmt.Fprintln(w, rr.Stack)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// print a report about a lock order inversion found by the online detection
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the lock order inversion
+//  Returns:
+//   nil
+func printReportLockOrderInversion(w io.Writer, r Report) {
+	fmt.Fprintf(w, colorFormat(red), "POTENTIAL DEADLOCK (LOCK ORDER INVERSION)\n\n")
+
+	// print the acquisitions which form the cycle
+	fmt.Fprintf(w, colorFormat(purple), "Acquisitions of locks involved in potential deadlock:\n\n")
+	for _, lr := range r.Locks {
+		fmt.Fprintf(w, colorFormat(blue), "Lock created at: ")
+		fmt.Fprintf(w, colorFormat(blue), fmt.Sprintf("%s:%d%s", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr)))
+		fmt.Fprintf(w, "\n")
+		for _, a := range lr.Acquisitions {
+			fmt.Fprintf(w, "acquired in routine %d at %s %d\n", lr.Routine, a.File, a.Line)
+		}
+		for _, c := range lr.CallStacks {
+			fmt.Fprint(w, c)
+		}
+		fmt.Fprintln(w, "")
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// print a report of the watchdog about a long wait or hold time
+//  Args:
+//   w (io.Writer): writer to which the report is written
+//   r (Report): report of the watchdog
+//  Returns:
+//   nil
+func printReportWatchdog(w io.Writer, r Report) {
+	if r.Type == DeadlockLongWait {
+		fmt.Fprintf(w, colorFormat(red), fmt.Sprintf("LONG LOCK WAIT (%s)\n\n", r.Duration))
+	} else {
+		fmt.Fprintf(w, colorFormat(red), fmt.Sprintf("LONG LOCK HOLD (%s)\n\n", r.Duration))
+	}
+
+	// print information about the lock
+	lr := r.Locks[0]
+	fmt.Fprintf(w, colorFormat(purple), "Initialization of lock:\n\n")
+	fmt.Fprintf(w, "%s %d%s\n", lr.Creation.File, lr.Creation.Line, lockAnnotation(lr))
+	fmt.Fprintln(w, "")
+
+	// print the acquisitions and the current call stacks of their routines
+	for i, lr := range r.Locks {
+		switch {
+		case r.Type == DeadlockLongHold:
+			fmt.Fprintf(w, colorFormat(purple), "Acquisition of the holder:\n\n")
+		case i == 0:
+			fmt.Fprintf(w, colorFormat(purple), "Waiting acquisition:\n\n")
+		default:
+			fmt.Fprintf(w, colorFormat(purple), "Acquisition of a current holder:\n\n")
+		}
+		for _, call := range lr.Acquisitions {
+			fmt.Fprintln(w, call.File, call.Line)
+		}
+		fmt.Fprintln(w, "")
+		for _, c := range lr.CallStacks {
+			fmt.Fprintln(w, c)
+		}
+	}
+	fmt.Fprintf(w, "\n")
 }
@@ -0,0 +1,454 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+resource.go
+This file implements resources. A resource is a pseudo lock, which represents
+a synchronization primitive other than a lock, e.g. a condition variable.
+Waiting for a resource is handled like acquiring a lock. A routine, which
+releases a resource (e.g. signals a condition variable) while holding a lock,
+is handled like a routine which acquires this lock while holding the resource,
+because the resource can only be released after the lock was acquired.
+This allows the detection of cycles between locks and other synchronization
+primitives with the lock trees.
+*/
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// set to 1 if a primitive is used, which needs the locks acquired by the
+// routines (WaitGroup or Chan)
+var acquiredLocksUsed uint32
+
+// check if the locks acquired by the routines are collected
+//  Returns:
+//   (bool): true if the acquired locks are collected, false otherwise
+func collectAcquiredLocks() bool {
+	return atomic.LoadUint32(&acquiredLocksUsed) == 1
+}
+
+// lock acquired by a routine
+type acquiredLock struct {
+	// the acquired lock
+	m mutexInt
+	// sequence number of the last acquisition of m by the routine
+	seq uint64
+}
+
+// type to implement a resource
+type resource struct {
+	// dummy mutex, the position of the resource in memory is the position of mu
+	mu sync.Mutex
+	// info about the creation and the usage of the resource
+	context []callerInfo
+	// lock to prevent concurrent access to context
+	contextLock sync.Mutex
+	// numberLocked is always 0, a resource can not be locked
+	numberLocked int32
+	// number of times the resource is held by a routine, by routine index
+	isLockedRoutineIndex map[int]int
+	// lock to prevent concurrent access to isLockedRoutineIndex
+	isLockedRoutineIndexLock sync.Mutex
+	// position of the resource in memory
+	memoryPosition uintptr
+	// name of the resource
+	name string
+	// internal ids of the routines, which released the resource for waiting
+	// routines without holding it, e.g. by signaling a condition variable
+	signalers map[int64]struct{}
+}
+
+// create a new resource
+//  Args:
+//   name (string): name of the resource, e.g. the kind of the primitive
+//   file (string): file in which the resource was created
+//   line (int): line in which the resource was created
+//  Returns:
+//   (*resource): the created resource
+func newResource(name string, file string, line int) *resource {
+	res := &resource{
+		isLockedRoutineIndex: map[int]int{},
+		name:                 name,
+	}
+	res.context = append(res.context, newInfo(file, line, true, ""))
+	res.memoryPosition = uintptr(unsafe.Pointer(&res.mu))
+	return res
+}
+
+// ============ GETTER ============
+
+// getter for isLocked
+//  Returns:
+//   (*int32): numberLocked
+func (res *resource) getNumberLocked() *int32 {
+	return &res.numberLocked
+}
+
+// getter for isLockedRoutineIndex
+//  Returns:
+//   (*int): isLockedRoutineIndex
+func (res *resource) getIsLockedRoutineIndex() *map[int]int {
+	return &res.isLockedRoutineIndex
+}
+
+// getter for isLockedRoutineIndexLock
+//  Returns:
+//   (*sync.Mutex): isLockedRoutineIndexLock
+func (res *resource) getIsLockedRoutineIndexLock() *sync.Mutex {
+	return &res.isLockedRoutineIndexLock
+}
+
+// getter for context
+//  Returns:
+//   (*[]callerInfo): caller info of the resource
+func (res *resource) getContext() *[]callerInfo {
+	return &res.context
+}
+
+// getter for contextLock
+//  Returns:
+//   (*sync.Mutex): contextLock
+func (res *resource) getContextLock() *sync.Mutex {
+	return &res.contextLock
+}
+
+// getter for memoryPosition
+//  Returns:
+//   (uintptr): memoryPosition
+func (res *resource) getMemoryPosition() uintptr {
+	return res.memoryPosition
+}
+
+// getter for class. Each resource is its own class
+//  Returns:
+//   (string): name and position of the creation of the resource
+func (res *resource) getClass() string {
+	creation := getCreation(res)
+	return fmt.Sprintf("%s@%s:%d", res.name, creation.file, creation.line)
+}
+
+// getter for name
+//  Returns:
+//   (string): name of the resource
+func (res *resource) getName() string {
+	return res.name
+}
+
+// getter for mu
+//  Returns:
+//   (bool): true
+//   (*sync.Mutex): dummy mutex of the resource
+//   (*sync.RWMutex): nil
+func (res *resource) getLock() (bool, *sync.Mutex, *sync.RWMutex) {
+	return true, &res.mu, nil
+}
+
+// empty getter, needed for mutexInt
+func (res *resource) getRLock(routineIndex int) bool {
+	return false
+}
+
+// empty setter, needed for mutexInt
+func (res *resource) setRLock(routineIndex int, value bool) {}
+
+// ============ FUNCTIONS ============
+
+// get the routine of the caller. A new routine is created if necessary
+//  Returns:
+//   (*routine): the routine, nil if the detection is disabled or the routine
+//    is not tracked
+func getResourceRoutine() *routine {
+	// return if detection is disabled
+	if !opts.activated ||
+		(!opts.periodicDetection && !opts.comprehensiveDetection) {
+		return nil
+	}
+
+	// create new routine, if not initialized
+	index := getRoutineIndex()
+	if index == -1 {
+		newRoutine()
+	}
+	index = getRoutineIndex()
+
+	// the routine is not tracked if the maximum number of routines is reached
+	if index == -1 {
+		return nil
+	}
+	return getRoutine(index)
+}
+
+// remember the routine with the internal id as signaler of res
+//  Args:
+//   id (int64): internal id of the routine
+//  Returns:
+//   nil
+func (res *resource) addSignaler(id int64) {
+	res.isLockedRoutineIndexLock.Lock()
+	defer res.isLockedRoutineIndexLock.Unlock()
+
+	if res.signalers == nil {
+		res.signalers = make(map[int64]struct{})
+	}
+	res.signalers[id] = struct{}{}
+}
+
+// get the internal ids of the signalers of res
+//  Returns:
+//   ([]int64): internal ids of the routines which signaled res
+func (res *resource) getSignalers() []int64 {
+	res.isLockedRoutineIndexLock.Lock()
+	defer res.isLockedRoutineIndexLock.Unlock()
+
+	ids := make([]int64, 0, len(res.signalers))
+	for id := range res.signalers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// update the detector data if the current routine waits for res. The
+// routine waits for res while holding all locks in its holding set except the
+// locks in except (e.g. the lock of a condition variable, which is released
+// while waiting)
+//  Args:
+//   res (*resource): resource the routine waits for
+//   except ([]mutexInt): locks which are not held while waiting
+//  Returns:
+//   nil
+func waitResource(res *resource, except ...mutexInt) {
+	r := getResourceRoutine()
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// get the locks held while waiting
+	hs := make([]mutexInt, 0, r.holdingCount)
+	for _, h := range r.holdingSet[:r.holdingCount] {
+		if !containsLock(except, h) {
+			hs = append(hs, h)
+		}
+	}
+
+	if len(hs) == 0 {
+		return
+	}
+
+	r.addResourceDependency(res, hs, r.getRLocks(hs))
+}
+
+// update the detector data if the current routine releases res. For each
+// lock h held by the routine except the locks in except, a dependency
+// (h, {res}) is added, because res can only be released after h was acquired
+//  Args:
+//   res (*resource): resource released by the routine
+//   except ([]mutexInt): locks which are ignored (e.g. the lock of a condition
+//    variable, which is released by the waiting routine)
+//  Returns:
+//   nil
+func signalResource(res *resource, except ...mutexInt) {
+	r := getResourceRoutine()
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, h := range r.holdingSet[:r.holdingCount] {
+		if !containsLock(except, h) {
+			r.addResourceDependency(h, []mutexInt{res}, []bool{false})
+		}
+	}
+}
+
+// remember that r acquired m, so that the next release of a resource by r
+// can depend on m.
+// r.lock must be held by the caller.
+//  Args:
+//   m (mutexInt): acquired lock
+//  Returns:
+//   nil
+func (r *routine) addAcquired(m mutexInt) {
+	if r.acquired == nil {
+		r.acquired = make(map[uintptr]acquiredLock)
+		r.lastRelease = make(map[*resource]uint64)
+	}
+	r.acquiredSeq++
+	r.acquired[lockKey(m)] = acquiredLock{m: m, seq: r.acquiredSeq}
+}
+
+// update the detector data if the current routine releases res, which can
+// only happen after all locks acquired before by the routine were acquired.
+// For each lock h held by the routine or acquired since its last release of
+// res, a dependency (h, {res}) is added.
+//  Args:
+//   res (*resource): resource released by the routine
+//  Returns:
+//   nil
+func releaseAcquiredResource(res *resource) {
+	r := getResourceRoutine()
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hs := []mutexInt{res}
+	hsRLocks := []bool{false}
+	held := r.holdingSet[:r.holdingCount]
+	for _, h := range held {
+		// resources held by the routine can not be acquired
+		if _, ok := h.(*resource); ok {
+			continue
+		}
+		r.addResourceDependency(h, hs, hsRLocks)
+	}
+
+	last := r.lastRelease[res]
+	for _, a := range r.acquired {
+		if a.seq > last && !containsLock(held, a.m) {
+			r.addResourceDependency(a.m, hs, hsRLocks)
+		}
+	}
+
+	if r.lastRelease == nil {
+		r.lastRelease = make(map[*resource]uint64)
+	}
+	r.lastRelease[res] = r.acquiredSeq
+}
+
+// add res to the holding set of the current routine. All locks acquired by
+// the routine until releaseResource is called depend on res, and routines
+// waiting for res wait for the routine in the periodical detection
+//  Args:
+//   res (*resource): resource held by the routine
+//  Returns:
+//   nil
+func holdResource(res *resource) {
+	r := getResourceRoutine()
+	if r == nil {
+		return
+	}
+
+	res.isLockedRoutineIndexLock.Lock()
+	res.isLockedRoutineIndex[r.index]++
+	res.isLockedRoutineIndexLock.Unlock()
+
+	// the resource is held from the position of its creation
+	creation := getCreation(res)
+	r.lock.Lock()
+	r.holdingSet = append(r.holdingSet[:r.holdingCount], res)
+	r.holdingInfo = append(r.holdingInfo[:r.holdingCount], creation)
+	r.holdingCount++
+	r.lock.Unlock()
+}
+
+// remove res from the holding set of the current routine
+//  Args:
+//   res (*resource): resource released by the routine
+//  Returns:
+//   (bool): true if the routine held res, false otherwise
+func releaseResource(res *resource) bool {
+	r := getResourceRoutine()
+	if r == nil || !r.holds(res) {
+		return false
+	}
+
+	res.isLockedRoutineIndexLock.Lock()
+	res.isLockedRoutineIndex[r.index]--
+	res.isLockedRoutineIndexLock.Unlock()
+
+	r.updateUnlock(res)
+	return true
+}
+
+// add the dependency (m, hs) created by waiting for or releasing a resource to
+// the lock tree of r and save the caller information.
+// r.lock must be held by the caller.
+//  Args:
+//   m (mutexInt): acquired lock or resource
+//   hs ([]mutexInt): locks and resources on which m depends
+//   hsRLocks ([]bool): true for the locks in hs which are held as reader lock
+//  Returns:
+//   nil
+func (r *routine) addResourceDependency(m mutexInt, hs []mutexInt, hsRLocks []bool) {
+	dep := r.addDependency(m, m.getRLock(r.index), hs, hsRLocks)
+	if dep == nil {
+		return
+	}
+
+	var stack string
+	if opts.collectCallStack || opts.onlineDetection {
+		stack = getCallStack(4)
+	}
+
+	// get the file and line from which the wait or release was initiated
+	_, file, line, _ := runtime.Caller(3)
+
+	// add the new caller information
+	info := newInfo(file, line, false, "")
+	if opts.collectCallStack {
+		info.callStacks = stack
+	}
+	dep.caller = info
+
+	// the caller information is saved in the resource
+	if _, ok := m.(*resource); ok {
+		addContext(m, info)
+	} else {
+		addContext(hs[0], info)
+	}
+
+	// check if the new dependency leads to a lock order inversion
+	if opts.onlineDetection {
+		addOnlineEdges(r, hs, hsRLocks, m, dep.rLock,
+			newInfo(file, line, false, stack))
+	}
+}
+
+// check if list contains the lock m
+//  Args:
+//   list ([]mutexInt): list of locks
+//   m (mutexInt): lock to search
+//  Returns:
+//   (bool): true if m is in list, false otherwise
+func containsLock(list []mutexInt, m mutexInt) bool {
+	for _, l := range list {
+		if l == m {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+response.go
+This file implements the reaction of the detector to detected actual
+deadlocks. Depending on the options, the program is terminated, a panic is
+raised, a user defined function is called or the program continues.
+*/
+
+import "os"
+
+// DeadlockType describes the kind of a detected deadlock
+type DeadlockType int
+
+const (
+	// DeadlockPotential is a potential deadlock found by the comprehensive
+	// detection
+	DeadlockPotential DeadlockType = iota
+	// DeadlockDoubleLocking is a routine trying to acquire a lock it already holds
+	DeadlockDoubleLocking
+	// DeadlockLocal is a local deadlock found by the periodical detection
+	DeadlockLocal
+	// DeadlockLockOrderInversion is a lock order inversion found by the online
+	// detection
+	DeadlockLockOrderInversion
+	// DeadlockTimeout is a potential deadlock, in which an acquisition is
+	// involved, which was canceled by its context or timeout
+	DeadlockTimeout
+	// DeadlockLongWait is a lock acquisition, which waits longer than the wait
+	// time threshold. It is found by the watchdog
+	DeadlockLongWait
+	// DeadlockLongHold is a lock, which is held longer than the hold time
+	// threshold. It is found by the watchdog
+	DeadlockLongHold
+	// DeadlockRecursiveRLock is a routine trying to r-lock a rw-lock it
+	// already holds as reader. This leads to a deadlock, if another routine
+	// tries to lock the rw-lock in between
+	DeadlockRecursiveRLock
+	// DeadlockUnlockNotLocked is the unlock of a lock, which is not locked.
+	// It is only reported if unlock diagnostics are enabled
+	DeadlockUnlockNotLocked
+	// DeadlockUnlockByOtherRoutine is the unlock of a lock by another routine
+	// than the one which acquired it. It is only reported if unlock
+	// diagnostics are enabled
+	DeadlockUnlockByOtherRoutine
+	// DeadlockUnbalancedUnlock is the RUnlock of a rw-lock acquired with Lock
+	// or the Unlock of a rw-lock acquired with RLock. It is only reported if
+	// unlock diagnostics are enabled
+	DeadlockUnbalancedUnlock
+	// DeadlockLockLeak is a routine, which terminated while holding locks
+	DeadlockLockLeak
+	// DeadlockHeldLocks are the locks held by a routine at the end of the
+	// program, found by the comprehensive detection
+	DeadlockHeldLocks
+)
+
+// String returns a readable representation of the deadlock type
+//  Returns:
+//   (string): name of the deadlock type
+func (t DeadlockType) String() string {
+	switch t {
+	case DeadlockPotential:
+		return "potential deadlock"
+	case DeadlockDoubleLocking:
+		return "double locking"
+	case DeadlockLocal:
+		return "local deadlock"
+	case DeadlockLockOrderInversion:
+		return "lock order inversion"
+	case DeadlockTimeout:
+		return "lock timeout"
+	case DeadlockLongWait:
+		return "long lock wait"
+	case DeadlockLongHold:
+		return "long lock hold"
+	case DeadlockRecursiveRLock:
+		return "recursive read locking"
+	case DeadlockUnlockNotLocked:
+		return "unlock of unlocked lock"
+	case DeadlockUnlockByOtherRoutine:
+		return "unlock by other routine"
+	case DeadlockUnbalancedUnlock:
+		return "unbalanced unlock"
+	case DeadlockLockLeak:
+		return "lock leak"
+	case DeadlockHeldLocks:
+		return "held locks"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the deadlock type as its name, e.g. for JSON reports
+//  Returns:
+//   ([]byte): name of the deadlock type
+//   (error): always nil
+func (t DeadlockType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// DeadlockError is the error which is used to inform about a detected
+// actual deadlock, if the deadlock response is set to ResponsePanic or
+// ResponseCallback. It is also the value of the panic on an unlock of an
+// unlocked lock.
+type DeadlockError struct {
+	// kind of the detected deadlock
+	Type DeadlockType
+	// report of the detected deadlock
+	Report Report
+	// error message, if it differs from the default message
+	message string
+}
+
+// Error returns the error message of a DeadlockError
+//  Returns:
+//   (string): error message
+func (e *DeadlockError) Error() string {
+	if e.message != "" {
+		return e.message
+	}
+	return "deadlock detected: " + e.Type.String()
+}
+
+// handleDeadlock reacts to a detected actual deadlock as defined by the
+// deadlock response in the options. The deadlock must already be reported.
+// A panic in the routine of the periodical detection could not be recovered
+// by the program, therefore ResponsePanic only reports deadlocks, which are
+// detected by the periodical detection.
+//  Args:
+//   report (Report): report of the detected deadlock
+//   detector (bool): true if the deadlock was detected by the periodical
+//    detection, false if it was detected in the blocked routine
+//  Returns:
+//   nil
+func handleDeadlock(report Report, detector bool) {
+	err := &DeadlockError{Type: report.Type, Report: report}
+
+	switch opts.deadlockResponse {
+	case ResponsePanic:
+		if detector {
+			return
+		}
+		panic(err)
+	case ResponseCallback:
+		opts.deadlockCallback(err)
+	case ResponseContinue:
+		return
+	default:
+		// run the comprehensive detection to find other possible deadlocks
+		// and terminate the program
+		FindPotentialDeadlocks()
+		os.Exit(2)
+	}
+}
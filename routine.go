@@ -31,10 +31,11 @@ to update these trees.
 */
 
 import (
-	"os"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/petermattis/goid"
 )
@@ -42,23 +43,40 @@ import (
 // map to map the internal routine id to index in routines
 var mapIndex = make(map[int64]int)
 
-// lock for the creation of a new routine
+// lock for the creation of a new routine. It also protects mapIndex,
+// routines, numberRoutines and routineRegistrations
 var createRoutineLock sync.Mutex
 
 // list of routines
-var routines = make([]routine, opts.maxRoutines)
+var routines []*routine
 
 // number of routines in routines
 var numberRoutines = 0
 
-// type to implement structures for lock logging
+// number of registered routines, including the terminated ones
+var routineRegistrations uint64
+
+// type to implement structures for lock logging.
+// The routine changes its own data, but other routines and the detectors read
+// it and a release of a lock by another routine changes the holding set.
+// Therefore the holding set, the lock tree, the vector clock and leakReported
+// are only accessed while lock is held. The detectors work on snapshots of the
+// routines.
 type routine struct {
+	// lock to prevent concurrent access to the data of the routine
+	lock *sync.Mutex
 	// index of the routine
 	index int
+	// internal go id of the routine
+	id int64
+	// value of routineRegistrations after the routine was registered
+	registration uint64
 	// number of currently hold locks
 	holdingCount int
 	// set of currently hold locks
 	holdingSet []mutexInt
+	// positions of the acquisitions of the locks in holdingSet
+	holdingInfo []callerInfo
 	// map of the dependencies
 	dependencyMap map[uintptr]*[]*dependency
 	// list of dependencies, implements the lock tree
@@ -69,8 +87,40 @@ type routine struct {
 	depCount int
 	// map to save information about collected single level
 	collectedSingleLevelLocks map[string][]int
+	// information about the lock the routine is currently blocked on
+	wait *routineWait
+	// current vector clock of the routine
+	vc vectorClock
+	// locks acquired by the routine, only collected if a WaitGroup or Chan
+	// is used
+	acquired map[uintptr]acquiredLock
+	// number of acquisitions added to acquired
+	acquiredSeq uint64
+	// value of acquiredSeq at the last release of a resource
+	lastRelease map[*resource]uint64
+	// true if the locks held by the routine at its termination were reported
+	leakReported bool
+}
+
+// type to store the lock a routine is currently blocked on. It is shared by
+// all copies of the routine
+type routineWait struct {
+	// lock the routine is blocked on, nil if it does not wait
+	m mutexInt
+	// true if the routine waits for m as reader lock
+	rLock bool
+	// sequence number of the current wait, unique over all waits
+	seq uint64
+	// true if the wait ends when its context is done (LockContext and
+	// LockTimeout)
+	cancelable bool
+	// lock to prevent concurrent access to the wait information
+	lock sync.Mutex
 }
 
+// counter for the sequence numbers of the waits
+var waitCounter uint64
+
 // Initialize a go routine
 // Returns:
 //  nil
@@ -80,45 +130,74 @@ func newRoutine() {
 		return
 	}
 
+	id := goid.Get()
+
+	// a routine, which was not tracked because the maximum number of routines
+	// was reached, stays untracked
+	if _, ok := untrackedRoutines.Load(id); ok {
+		return
+	}
+
 	// lock the routine list
 	createRoutineLock.Lock()
 
+	if len(freeRoutineIndices) == 0 && numberRoutines >= opts.maxRoutines &&
+		time.Since(lastReclaim) >= minReclaimInterval {
+		// try to reclaim the slots of terminated routines if the maximum number
+		// of routines is reached. The reclamation takes the lock itself
+		createRoutineLock.Unlock()
+		reclaimRoutines()
+		createRoutineLock.Lock()
+	}
+
+	// get the index of the new routine. Reuse the slot of a terminated
+	// routine if possible
+	index := numberRoutines
+	if len(freeRoutineIndices) != 0 {
+		index = freeRoutineIndices[len(freeRoutineIndices)-1]
+		freeRoutineIndices = freeRoutineIndices[:len(freeRoutineIndices)-1]
+	} else if numberRoutines >= opts.maxRoutines {
+		// the routine is not tracked if the maximum is still reached
+		untrackedRoutines.Store(id, struct{}{})
+		createRoutineLock.Unlock()
+		warnOnce(`Number of routines is greater than max number of routines.
+Locks in additional routines are not considered by the detection. Increase
+the maximum number of routines with SetMaxRoutines.`)
+		return
+	}
+
 	// create the routine
 	r := routine{
-		index:                     numberRoutines,
+		lock:                      &sync.Mutex{},
+		index:                     index,
+		id:                        id,
+		registration:              routineRegistrations + 1,
 		holdingCount:              0,
-		holdingSet:                make([]mutexInt, opts.maxNumberOfDependentLocks),
+		holdingSet:                make([]mutexInt, 0),
+		holdingInfo:               make([]callerInfo, 0),
 		dependencyMap:             make(map[uintptr]*[]*dependency),
-		dependencies:              make([]*dependency, opts.maxDependencies),
+		dependencies:              make([]*dependency, 0),
 		curDep:                    nil,
 		depCount:                  0,
 		collectedSingleLevelLocks: make(map[string][]int),
+		wait:                      &routineWait{},
+		vc:                        newVectorClock(id),
 	}
 
-	// the routine list can only contain a fixed amount of routines
-	// panic if it already full
-	if numberRoutines >= opts.maxRoutines {
-		panic(`Number of routines is greater than max number of routines. 
-			Increase Opts.MaxRoutines.`)
+	// set the routine or add it to the list, if no slot was reused
+	if index == numberRoutines {
+		routines = append(routines, &r)
+		numberRoutines++
+	} else {
+		routines[index] = &r
 	}
 
-	// set the routine
-	routines[numberRoutines] = r
-
 	// save the link from internal go id to index of routine
-	mapIndex[goid.Get()] = numberRoutines
-
-	// increase number of routines in routine
-	numberRoutines++
+	mapIndex[id] = index
+	routineRegistrations++
 
 	// release list lock
 	createRoutineLock.Unlock()
-
-	// allocate the dependency list
-	// for i := 0; i < opts.maxDependencies; i++ {
-	// 	dep := newDependency(nil, nil, 0)
-	// 	r.dependencies[i] = &dep
-	// }
 }
 
 // Update the routine structure if a mutex is locked
@@ -127,6 +206,9 @@ func newRoutine() {
 // Returns:
 //  nil
 func (r *routine) updateLock(m mutexInt, rLock bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	hc := r.holdingCount
 
 	m.setRLock(r.index, rLock)
@@ -135,55 +217,14 @@ func (r *routine) updateLock(m mutexInt, rLock bool) {
 
 	// if lock is not a single level lock -> found nested lock
 	if hc > 0 {
-		// calculate the key corresponding to the dependency from the memory addresses
-		// of m and the last mutex which was added to the list of mutexes which
-		// are currently held by r
-		key := m.getMemoryPosition() ^ r.holdingSet[hc-1].getMemoryPosition()
-
-		depMap := r.dependencyMap
-
-		// check if the key already exists in depMap
-		d, ok := depMap[key]
-
-		panicMassage := `Number of dependencies is greater than max number of 
-			dependencies. Increase Opts.MaxDependencies.`
-
-		// Check if the key does not exists or if it exists, that the current
-		// dependency, created by locking m is not already in the list of
-		// dependencies associated with that key. In this case the dependency
-		// will be added to the lock tree
-		if !(ok && r.dependencyAlreadyExists(m, d)) {
-			// panic if the number of number of dependencies in the lock tree exceeds
-			// it maximum
-			if r.depCount >= opts.maxDependencies {
-				panic(panicMassage)
-			}
-			// add the new dependency to the lock tree
-			dep := newDependency(m, r.holdingSet, hc)
-			r.dependencies[r.depCount] = &dep
-			dep.update(m, &r.holdingSet, hc)
-			r.depCount++
-
-			// add the dependency to the dependencyMap
-			if d != nil {
-				*d = append(*d, &dep)
-			} else {
-				d = &[]*dependency{&dep}
-			}
-			r.dependencyMap[key] = d
-
-			// set the last added dependency pf the tree
-			r.curDep = &dep
-
-			isNew = true
-		}
-
+		hs := r.holdingSet[:hc]
+		isNew = r.addDependency(m, rLock, hs, r.getRLocks(hs)) != nil
 	} else {
 		// save information on single level locks if enabled in the options
 		// to avoid creating the caller info multiple times
 		if opts.collectSingleLevelLockStack {
 			// get caller information
-			_, file, line, _ := runtime.Caller(3)
+			_, file, line, _ := runtime.Caller(4)
 
 			// check if a lock of a single level lock was already called in the same file
 			if lines, ok := r.collectedSingleLevelLocks[file]; ok {
@@ -215,65 +256,244 @@ func (r *routine) updateLock(m mutexInt, rLock bool) {
 	if isNew && (hc > 0 || opts.collectSingleLevelLockStack) {
 		var file string
 		var line int
-		var bufStringCleaned string
+		var stack string
 
-		// get the call stack if call stack collection is enabled
-		if opts.collectCallStack {
-			var bufString string
-			buf := make([]byte, opts.maxCallStackSize)
-			n := runtime.Stack(buf[:], false)
-			bufString = string(buf[:n])
-			bufStringSplit := strings.Split(bufString, "\n")
-			bufStringCleaned = bufStringSplit[0] + "\n"
-			for i := 7; i < len(bufStringSplit); i++ {
-				bufStringCleaned += bufStringSplit[i] + "\n"
-			}
+		// get the call stack if call stack collection or the online detection
+		// is enabled
+		if opts.collectCallStack || (hc > 0 && opts.onlineDetection) {
+			stack = getCallStack(5)
 		}
 
 		// get the file and line from which the locking was initiated
-		_, file, line, _ = runtime.Caller(3)
+		_, file, line, _ = runtime.Caller(4)
 
 		// add the new caller information
-		context := m.getContext()
-		*context = append(*context, newInfo(file, line, false, bufStringCleaned))
+		info := newInfo(file, line, false, "")
+		if opts.collectCallStack {
+			info.callStacks = stack
+		}
+		addContext(m, info)
+
+		if hc > 0 {
+			// save the caller information in the newly created dependency
+			r.curDep.caller = info
+
+			// check if the new dependency leads to a lock order inversion
+			if opts.onlineDetection {
+				hs := r.holdingSet[:hc]
+				addOnlineEdges(r, hs, r.getRLocks(hs), m, rLock,
+					newInfo(file, line, false, stack))
+			}
+		}
 	}
 
-	// panic if the holding depth exceeds its maximum
-	if hc >= opts.maxNumberOfDependentLocks {
-		panic(`Holding Count is grater than maximum number of dependent locks. 
-		Increase Opts.maxNumberOfDependentLocks.`)
+	// remember the lock for the next release of a resource
+	if collectAcquiredLocks() {
+		r.addAcquired(m)
 	}
 
-	// add the lock to the holding set of the routine
-	r.holdingSet[hc] = m
+	// add the lock and the position of its acquisition to the holding set of
+	// the routine
+	_, file, line, _ := runtime.Caller(4)
+	r.holdingSet = append(r.holdingSet[:hc], m)
+	r.holdingInfo = append(r.holdingInfo[:hc], newInfo(file, line, false, ""))
 	r.holdingCount++
 }
 
-// check if the dependency which results from locking m already exists in list
+// add the dependency, which is created by acquiring m while holding the
+// locks in hs, to the lock tree of r, if it does not exist yet. If hs contains
+// more than the maximum number of dependent locks, only the last locks are used.
+// r.lock must be held by the caller.
+//  Args:
+//   m (mutexInt): acquired lock
+//   rLock (bool): true if m is acquired as reader lock
+//   hs ([]mutexInt): locks held while m is acquired
+//   hsRLocks ([]bool): true for the locks in hs which are held as reader lock
+//  Returns:
+//   (*dependency): the new dependency, nil if the dependency already existed
+func (r *routine) addDependency(m mutexInt, rLock bool, hs []mutexInt,
+	hsRLocks []bool) *dependency {
+	// only the last locks in the holding set are used for the dependency,
+	// if the routine holds more than the maximum number of dependent locks
+	if len(hs) > opts.maxNumberOfDependentLocks {
+		warnOnce(`Holding count is greater than maximum number of dependent
+locks. Only the last locks are used. Increase the maximum number of dependent
+locks with SetMaxNumberOfDependentLocks.`)
+		hs = hs[len(hs)-opts.maxNumberOfDependentLocks:]
+		hsRLocks = hsRLocks[len(hsRLocks)-opts.maxNumberOfDependentLocks:]
+	}
+
+	// calculate the key corresponding to the dependency from the memory addresses
+	// of m and the last mutex which was added to the list of mutexes which
+	// are currently held by r
+	key := lockKey(m) ^ lockKey(hs[len(hs)-1])
+
+	// check if the key already exists in depMap
+	d, ok := r.dependencyMap[key]
+
+	// Check if the key exists and the current dependency, created by locking m
+	// is already in the list of dependencies associated with that key. In this
+	// case the dependency is not added to the lock tree, only the clock of its
+	// last occurrence is updated
+	if ok {
+		if existing := findDependency(m, rLock, hs, hsRLocks, d); existing != nil {
+			existing.lastVC = r.vc
+			return nil
+		}
+	}
+
+	// remove the oldest dependency if the number of dependencies in the
+	// lock tree exceeds its maximum
+	if r.depCount >= opts.maxDependencies {
+		warnOnce(`Number of dependencies is greater than max number of
+dependencies. The oldest dependencies are removed. Increase the maximum number
+of dependencies with SetMaxDependencies.`)
+		r.removeOldestDependency()
+		d = r.dependencyMap[key]
+	}
+
+	// add the new dependency to the lock tree
+	dep := newDependency(m, rLock, hs, hsRLocks, len(hs))
+	dep.id = r.id
+	dep.firstVC = r.vc
+	dep.lastVC = r.vc
+	r.dependencies = append(r.dependencies, &dep)
+	r.depCount++
+	atomic.AddUint64(&dependencyVersion, 1)
+
+	// add the dependency to the dependencyMap
+	if d != nil {
+		*d = append(*d, &dep)
+	} else {
+		d = &[]*dependency{&dep}
+	}
+	r.dependencyMap[key] = d
+
+	// set the last added dependency pf the tree
+	r.curDep = &dep
+
+	return &dep
+}
+
+// get the call stack of the current routine
+//  Args:
+//   skip (int): number of frames to skip, starting with getCallStack
+//  Returns:
+//   (string): the call stack
+func getCallStack(skip int) string {
+	// increase the buffer until the call stack fits or the buffer has
+	// reached the maximum call stack size
+	size := 1024
+	if size > opts.maxCallStackSize {
+		size = opts.maxCallStackSize
+	}
+	var buf []byte
+	var n int
+	for {
+		buf = make([]byte, size)
+		n = runtime.Stack(buf, false)
+		if n < size {
+			break
+		}
+		if size >= opts.maxCallStackSize {
+			warnOnce(`Call stacks are longer than the maximum call stack size and
+are truncated. Increase the maximum call stack size with SetMaxCallStackSize.`)
+			break
+		}
+		size *= 2
+		if size > opts.maxCallStackSize {
+			size = opts.maxCallStackSize
+		}
+	}
+	bufStringSplit := strings.Split(string(buf[:n]), "\n")
+
+	// the first line contains the id of the routine, each frame consists of
+	// two lines
+	bufStringCleaned := bufStringSplit[0] + "\n"
+	for i := 1 + 2*skip; i < len(bufStringSplit); i++ {
+		bufStringCleaned += bufStringSplit[i] + "\n"
+	}
+	return bufStringCleaned
+}
+
+// get for each lock in hs, whether it is held as reader lock by r
+//  Args:
+//   hs ([]mutexInt): locks held by r
+//  Returns:
+//   ([]bool): true for the locks in hs which are held as reader lock
+func (r *routine) getRLocks(hs []mutexInt) []bool {
+	res := make([]bool, len(hs))
+	for i, m := range hs {
+		res[i] = m.getRLock(r.index)
+	}
+	return res
+}
+
+// remove the oldest dependency from the lock tree of r.
+// r.lock must be held by the caller.
+//  Returns:
+//   nil
+func (r *routine) removeOldestDependency() {
+	if r.depCount == 0 {
+		return
+	}
+
+	oldest := r.dependencies[0]
+	r.dependencies[0] = nil
+	r.dependencies = r.dependencies[1:]
+	r.depCount--
+
+	if r.curDep == oldest {
+		r.curDep = nil
+	}
+
+	// remove the dependency from the dependencyMap
+	key := lockKey(oldest.mu) ^ lockKey(oldest.holdingSet[oldest.holdingCount-1])
+	d, ok := r.dependencyMap[key]
+	if !ok {
+		return
+	}
+	for i, dep := range *d {
+		if dep == oldest {
+			*d = append((*d)[:i], (*d)[i+1:]...)
+			break
+		}
+	}
+	if len(*d) == 0 {
+		delete(r.dependencyMap, key)
+	}
+}
+
+// get the dependency which results from locking m from list, if it already exists
 //  Args:
 //   m (mutexInt): mutex which gets locked
+//   rLock (bool): true if m gets locked as reader lock
+//   hs ([]mutexInt): locks on which m depends
+//   hsRLocks ([]bool): true for the locks in hs which are held as reader lock
 //   depList (*([]*dependency)): list to check in
 //  Returns:
-//   true if dependency already exist
-func (r *routine) dependencyAlreadyExists(m mutexInt, depList *([]*dependency)) bool {
+//   (*dependency): the existing dependency, nil if it does not exist
+func findDependency(m mutexInt, rLock bool, hs []mutexInt,
+	hsRLocks []bool, depList *([]*dependency)) *dependency {
 	// traverse depList
 	for _, d := range *depList {
-		hc := r.holdingCount
+		hc := len(hs)
 
 		// check if dependency with same lock and holding count exists
-		if d.mu == m && d.holdingCount == hc {
+		if mutexHaveEqualLock(d.mu, m) && d.rLock == rLock && d.holdingCount == hc {
 			// check if the holdingSets in the dependency and the routine are equal
 			i := 0
-			for d.holdingSet[i] == r.holdingSet[i] && i < hc {
+			for i < hc && mutexHaveEqualLock(d.holdingSet[i], hs[i]) &&
+				d.holdingRLock[i] == hsRLocks[i] {
 				i++
 			}
 			if i == hc {
-				return true
+				return d
 			}
 		}
 	}
 
-	return false
+	return nil
 }
 
 // update the routine data structure if tryLock is successfully
@@ -283,35 +503,154 @@ func (r *routine) dependencyAlreadyExists(m mutexInt, depList *([]*dependency))
 //  Returns:
 //   nil
 func (r *routine) updateTryLock(m mutexInt, rLock bool) {
-	// panic if the number of locks in the holding set exceeds its maximum
-	hc := r.holdingCount
-	if hc >= opts.maxNumberOfDependentLocks {
-		panic(`Holding Count is grater than maximum holding depth. Increase 
-			Opts.MaxHoldingDepth.`)
-	}
-
 	m.setRLock(r.index, rLock)
 
-	// add the lock to the holding set
-	r.holdingSet[hc] = m
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// add the lock and the position of its acquisition to the holding set
+	_, file, line, _ := runtime.Caller(3)
+	r.holdingSet = append(r.holdingSet[:r.holdingCount], m)
+	r.holdingInfo = append(r.holdingInfo[:r.holdingCount], newInfo(file, line, false, ""))
 	r.holdingCount++
 }
 
-// Update the routine data structure is a mutex is unlocked
+// record that the routine is blocked on m until stopWaiting is called
+//  Args:
+//   m (mutexInt): lock the routine waits for
+//   rLock (bool): true if m is acquired as reader lock
+//   cancelable (bool): true if the wait ends when its context is done
+//  Returns:
+//   nil
+func (r *routine) startWaiting(m mutexInt, rLock bool, cancelable bool) {
+	seq := atomic.AddUint64(&waitCounter, 1)
+
+	r.wait.lock.Lock()
+	r.wait.m = m
+	r.wait.rLock = rLock
+	r.wait.seq = seq
+	r.wait.cancelable = cancelable
+	r.wait.lock.Unlock()
+}
+
+// record that the routine is no longer blocked
+//  Returns:
+//   nil
+func (r *routine) stopWaiting() {
+	r.wait.lock.Lock()
+	r.wait.m = nil
+	r.wait.lock.Unlock()
+}
+
+// get the lock the routine is currently blocked on
+//  Returns:
+//   (mutexInt): lock the routine waits for, nil if it does not wait
+//   (bool): true if the lock is acquired as reader lock
+//   (uint64): sequence number of the wait
+//   (bool): true if the wait ends when its context is done
+func (r *routine) getWaiting() (mutexInt, bool, uint64, bool) {
+	// the slots of reclaimed routines have no wait information
+	if r.wait == nil {
+		return nil, false, 0, false
+	}
+
+	r.wait.lock.Lock()
+	defer r.wait.lock.Unlock()
+	return r.wait.m, r.wait.rLock, r.wait.seq, r.wait.cancelable
+}
+
+// Update the routine data structure is a mutex is unlocked. The mutex can
+// also be released by another routine than r.
 //  Args:
 //   m (mutexInt): mutex which was released
 //  Returns:
 //   nil
 func (r *routine) updateUnlock(m mutexInt) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	// remove m from the holding set of r
 	for i := r.holdingCount - 1; i >= 0; i-- {
 		if r.holdingSet[i] == m {
 			r.holdingSet = append(r.holdingSet[:i], r.holdingSet[i+1:]...)
-			r.holdingSet = append(r.holdingSet, nil)
+			r.holdingInfo = append(r.holdingInfo[:i], r.holdingInfo[i+1:]...)
 			r.holdingCount--
 			break
 		}
 	}
+
+	// reset the reader information of r if it does not hold m anymore, so
+	// that a routine which reuses the slot of r does not inherit it
+	for i := 0; i < r.holdingCount; i++ {
+		if r.holdingSet[i] == m {
+			return
+		}
+	}
+	m.setRLock(r.index, false)
+}
+
+// get the position of the acquisition of m by r
+//  Args:
+//   m (mutexInt): lock held by r
+//  Returns:
+//   (callerInfo): position of the first acquisition of m in the holding set
+//    of r, empty if r does not hold m
+func (r *routine) getHoldingInfo(m mutexInt) callerInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := 0; i < r.holdingCount; i++ {
+		if r.holdingSet[i] == m {
+			return r.holdingInfo[i]
+		}
+	}
+	return callerInfo{}
+}
+
+// check if r holds m
+//  Args:
+//   m (mutexInt): lock or resource to check for
+//  Returns:
+//   (bool): true if m is in the holding set of r, false otherwise
+func (r *routine) holds(m mutexInt) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return containsLock(r.holdingSet[:r.holdingCount], m)
+}
+
+// create a copy of the lock tree of r, which can be used by the detectors
+// while r continues to run. The dependencies are copied as well, because the
+// clock of the last occurrence of a dependency still changes.
+//  Returns:
+//   (routine): the copy of r
+func (r *routine) snapshot() routine {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s := routine{
+		index:        r.index,
+		id:           r.id,
+		dependencies: make([]*dependency, 0, r.depCount),
+		depCount:     r.depCount,
+	}
+	for _, dep := range r.dependencies[:r.depCount] {
+		d := *dep
+		s.dependencies = append(s.dependencies, &d)
+	}
+	return s
+}
+
+// Get the routine with the given index in routines
+//  Args:
+//   index (int): index of the routine
+//  Returns:
+//   (*routine): the routine
+func getRoutine(index int) *routine {
+	createRoutineLock.Lock()
+	defer createRoutineLock.Unlock()
+
+	return routines[index]
 }
 
 // Get the index of the routine which calls getRoutineIndex in routines
@@ -344,17 +683,23 @@ func getRoutineIndex() int {
 //   nil
 func (r *routine) checkDoubleLocking(m mutexInt, routineIndex int, rLock bool) {
 	// it can only be double locking, if the routine already holds the lock
-	if (*m.getIsLockedRoutineIndex())[routineIndex] == 0 {
+	m.getIsLockedRoutineIndexLock().Lock()
+	count := (*m.getIsLockedRoutineIndex())[routineIndex]
+	m.getIsLockedRoutineIndexLock().Unlock()
+	if count == 0 {
 		return
 	}
 
-	// no double locking of two reader
+	// two reader locks are no double locking, but they can lead to a deadlock
+	// with a waiting writer
 	if rLock && m.getRLock(routineIndex) {
+		reportRecursiveRLock(newReportRecursiveRLock(m, routineIndex,
+			r.getHoldingInfo(m)))
 		return
 	}
 
-	// report double locking and terminate the program
-	reportDeadlockDoubleLocking(m)
-	FindPotentialDeadlocks()
-	os.Exit(2)
+	// report double locking and react as set in the options
+	report := newReportDoubleLocking(m, routineIndex)
+	printReports([]Report{report})
+	handleDeadlock(report, false)
 }
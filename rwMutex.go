@@ -31,65 +31,111 @@ the lock, r-lock and unlock operations for these locks.
 */
 
 import (
+	"context"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 // type to implement a lock
+// The zero value is an unlocked rw-mutex, which gets initialized on its
+// first use.
 type RWMutex struct {
 	// rw-mutex for the actual locking
-	mu *sync.RWMutex
+	mu sync.RWMutex
 	// info about the creation and lock/unlock of this lock
 	context []callerInfo
-	// set to true after lock was initialized
-	in bool
-	// how ofter is the lock locked
-	numberLocked int
+	// lock to prevent concurrent access to context, class and name
+	contextLock sync.Mutex
+	// set to 1 after lock was initialized
+	in uint32
+	// lock to prevent multiple concurrent initializations of the lock
+	inLock sync.Mutex
+	// how ofter is the lock locked, only accessed atomically
+	numberLocked int32
 	// indexes of the routines, which holds the lock
 	isLockedRoutineIndex map[int]int
 	// lock to prevent multiple concurrent writes to isLockedRoutineIndex
-	isLockedRoutineIndexLock *sync.Mutex
+	isLockedRoutineIndexLock sync.Mutex
 	// position of the mutex in memory
 	memoryPosition uintptr
+	// class of the lock, set with SetClass
+	class string
+	// name of the lock, set with SetName
+	name string
 	// save for the routine index if the lock was locked by rLock
 	isRLock map[int]bool
-	// lock to prevent concurrent writes to isRLock
-	isRLockLock *sync.Mutex
+	// lock to prevent concurrent access to isRLock
+	isRLockLock sync.Mutex
 }
 
 // create a new rw-lock
+//  Returns:
+//   (*RWMutex): the created rw-lock
 func NewRWLock() *RWMutex {
-	// initialize detector if necessary
-	if !initialized {
-		initialize()
+	m := &RWMutex{}
+	m.init()
+	return m
+}
+
+// create and return a new named rw-mutex. The name is used in all reports of
+// the lock. If lock classes are enabled and no class is set, the name is
+// also used as class of the lock.
+//  Args:
+//   name (string): name of the lock
+//  Returns:
+//   (*RWMutex): the created rw-lock
+func NewRWLockNamed(name string) *RWMutex {
+	m := &RWMutex{}
+	m.init()
+	m.name = name
+	return m
+}
+
+// init initializes the rw-lock if it has not been initialized yet.
+// This allows the usage of a zero value RWMutex. The position of the caller
+// of the function that called init (NewRWLock or the first (R)Lock) is saved
+// as the creation of the lock.
+//  Returns:
+//   nil
+func (m *RWMutex) init() {
+	// fast path if the lock is already initialized
+	if atomic.LoadUint32(&m.in) == 1 {
+		return
 	}
 
-	m := RWMutex{
-		mu:                       &sync.RWMutex{},
-		in:                       true,
-		isLockedRoutineIndex:     map[int]int{},
-		isLockedRoutineIndexLock: &sync.Mutex{},
-		isRLock:                  map[int]bool{},
-		isRLockLock:              &sync.Mutex{},
+	m.inLock.Lock()
+	defer m.inLock.Unlock()
+
+	// another routine may have initialized the lock in the meantime
+	if m.in == 1 {
+		return
 	}
 
-	// save the position of the NewLock call
-	_, file, line, _ := runtime.Caller(1)
+	// initialize detector if necessary
+	initialize()
+
+	m.isLockedRoutineIndex = map[int]int{}
+	m.isRLock = map[int]bool{}
+
+	// save the position of the NewRWLock or first Lock call
+	_, file, line, _ := runtime.Caller(2)
 	m.context = append(m.context, newInfo(file, line, true, ""))
 
 	// save the memory position of the mutex
-	m.memoryPosition = uintptr(unsafe.Pointer(&m))
+	m.memoryPosition = uintptr(unsafe.Pointer(m))
 
-	return &m
+	atomic.StoreUint32(&m.in, 1)
 }
 
 // ====== GETTER ===============================================================
 
 // getter for isLocked
 //  Returns:
-//   (*int): numberLocked
-func (m *RWMutex) getNumberLocked() *int {
+//   (*int32): numberLocked
+func (m *RWMutex) getNumberLocked() *int32 {
 	return &m.numberLocked
 }
 
@@ -104,7 +150,7 @@ func (m *RWMutex) getIsLockedRoutineIndex() *map[int]int {
 //  Returns:
 //   (*int): isLockedRoutineIndex
 func (m *RWMutex) getIsLockedRoutineIndexLock() *sync.Mutex {
-	return m.isLockedRoutineIndexLock
+	return &m.isLockedRoutineIndexLock
 }
 
 // getter for context
@@ -114,6 +160,13 @@ func (m *RWMutex) getContext() *[]callerInfo {
 	return &m.context
 }
 
+// getter for contextLock
+//  Returns:
+//   (*sync.Mutex): contextLock
+func (m *RWMutex) getContextLock() *sync.Mutex {
+	return &m.contextLock
+}
+
 // getter for memoryPosition
 //  Returns:
 //   (uintptr): memoryPosition
@@ -121,11 +174,24 @@ func (m *RWMutex) getMemoryPosition() uintptr {
 	return m.memoryPosition
 }
 
-// getter for in
+// getter for class
+//  Returns:
+//   (string): class of the lock, empty if no class was set
+func (m *RWMutex) getClass() string {
+	m.contextLock.Lock()
+	defer m.contextLock.Unlock()
+
+	return m.class
+}
+
+// getter for name
 //  Returns:
-//   (bool): true if the lock was initialized, false otherwise
-func (m *RWMutex) getIn() *bool {
-	return &m.in
+//   (string): name of the lock, empty if no name was set
+func (m *RWMutex) getName() string {
+	m.contextLock.Lock()
+	defer m.contextLock.Unlock()
+
+	return m.name
 }
 
 // getter for mu
@@ -134,7 +200,7 @@ func (m *RWMutex) getIn() *bool {
 //   (*sync.Mutex): nil, underlying sync.Mutex mu for mutex
 //   (*sync.RWMutex): nil, underlying sync.RWMutex mu
 func (m *RWMutex) getLock() (bool, *sync.Mutex, *sync.RWMutex) {
-	return false, nil, m.mu
+	return false, nil, &m.mu
 }
 
 // get whether the lock was created by an rlock
@@ -143,6 +209,9 @@ func (m *RWMutex) getLock() (bool, *sync.Mutex, *sync.RWMutex) {
 //  Returns:
 //   bool. true if it was last locked by rlock, false otherwise
 func (m *RWMutex) getRLock(routineIndex int) bool {
+	m.isRLockLock.Lock()
+	defer m.isRLockLock.Unlock()
+
 	ok, res := m.isRLock[routineIndex]
 	if !ok {
 		return false
@@ -157,17 +226,45 @@ func (m *RWMutex) getRLock(routineIndex int) bool {
 //  Returns:
 //   nil
 func (m *RWMutex) setRLock(routineIndex int, value bool) {
-	m.isLockedRoutineIndexLock.Lock()
+	m.isRLockLock.Lock()
 	m.isRLock[routineIndex] = value
-	m.isLockedRoutineIndexLock.Unlock()
+	m.isRLockLock.Unlock()
 }
 
 // ====== FUNCTIONS ============================================================
 
+// SetClass sets the class of rw-mutex m. If lock classes are enabled, all locks
+// with the same class share one node in the lock trees. Locks without a class
+// are grouped by the position of their creation.
+//  Args:
+//   class (string): name of the class
+//  Returns:
+//   nil
+func (m *RWMutex) SetClass(class string) {
+	m.init()
+	m.contextLock.Lock()
+	m.class = class
+	m.contextLock.Unlock()
+}
+
+// SetName sets the name of rw-mutex m. The name is used in all reports of the
+// lock.
+//  Args:
+//   name (string): name of the lock
+//  Returns:
+//   nil
+func (m *RWMutex) SetName(name string) {
+	m.init()
+	m.contextLock.Lock()
+	m.name = name
+	m.contextLock.Unlock()
+}
+
 // Lock rw-mutex m
 //  Returns:
 //   nil
 func (m *RWMutex) Lock() {
+	m.init()
 	// call the lock method for the mutexInt interface
 	lockInt(m, false)
 }
@@ -176,25 +273,96 @@ func (m *RWMutex) Lock() {
 //  Returns:
 //   nil
 func (m *RWMutex) RLock() {
+	m.init()
 	// call the lock method for the mutexInt interface
 	lockInt(m, true)
 }
 
+// LockContext locks rw-mutex m, unless ctx is done before the lock could be
+// acquired. If the canceled acquisition is part of a potential deadlock, the
+// deadlock is reported.
+//  Args:
+//   ctx (context.Context): context of the acquisition
+//  Returns:
+//   (error): nil if m was locked, the error of ctx otherwise
+func (m *RWMutex) LockContext(ctx context.Context) error {
+	m.init()
+	// call the lock method for the mutexInt interface
+	return lockContextInt(ctx, m, false)
+}
+
+// RLockContext r-locks rw-mutex m, unless ctx is done before the lock could be
+// acquired. If the canceled acquisition is part of a potential deadlock, the
+// deadlock is reported.
+//  Args:
+//   ctx (context.Context): context of the acquisition
+//  Returns:
+//   (error): nil if m was r-locked, the error of ctx otherwise
+func (m *RWMutex) RLockContext(ctx context.Context) error {
+	m.init()
+	// call the lock method for the mutexInt interface
+	return lockContextInt(ctx, m, true)
+}
+
+// LockTimeout locks rw-mutex m, unless the lock could not be acquired within
+// the duration d. If the canceled acquisition is part of a potential deadlock,
+// the deadlock is reported.
+//  Args:
+//   d (time.Duration): maximum time to wait for the lock
+//  Returns:
+//   (bool): true if locking was successful, false otherwise
+func (m *RWMutex) LockTimeout(d time.Duration) bool {
+	m.init()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	// call the lock method for the mutexInt interface
+	return lockContextInt(ctx, m, false) == nil
+}
+
+// RLockTimeout r-locks rw-mutex m, unless the lock could not be acquired
+// within the duration d. If the canceled acquisition is part of a potential
+// deadlock, the deadlock is reported.
+//  Args:
+//   d (time.Duration): maximum time to wait for the lock
+//  Returns:
+//   (bool): true if r-locking was successful, false otherwise
+func (m *RWMutex) RLockTimeout(d time.Duration) bool {
+	m.init()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	// call the lock method for the mutexInt interface
+	return lockContextInt(ctx, m, true) == nil
+}
+
 // TryLock rw-mutex m
 //  Returns:
 //   (bool): true if locking was successful, false otherwise
 func (m *RWMutex) TryLock() bool {
+	m.init()
 	// call the try-lock method for the mutexInt interface
 	res := tryLockInt(m, false)
 	return res
 }
 
-// TryLock rw-mutex m
+// TryRLock rw-mutex m
 //  Returns:
-//   (bool): true if locking was successful, false otherwise
+//   (bool): true if r-locking was successful, false otherwise
+func (m *RWMutex) TryRLock() bool {
+	m.init()
+	// call the try-lock method for the mutexInt interface
+	res := tryLockInt(m, true)
+	return res
+}
+
+// RTryLock rw-mutex m
+//
+// Deprecated: use TryRLock, which matches the name in sync.RWMutex
+//  Returns:
+//   (bool): true if r-locking was successful, false otherwise
 func (m *RWMutex) RTryLock() bool {
+	m.init()
 	// call the try-lock method for the mutexInt interface
-	res := tryLockInt(m, false)
+	res := tryLockInt(m, true)
 	return res
 }
 
@@ -202,8 +370,9 @@ func (m *RWMutex) RTryLock() bool {
 //  Returns:
 //   nil
 func (m *RWMutex) Unlock() {
+	m.init()
 	if opts.activated {
-		unlockInt(m)
+		unlockInt(m, false)
 	}
 	m.mu.Unlock()
 }
@@ -211,8 +380,42 @@ func (m *RWMutex) Unlock() {
 // Unlock rw-mutex m
 //  Returns: nil
 func (m *RWMutex) RUnlock() {
+	m.init()
+	if opts.activated {
+		unlockInt(m, true)
+	}
+	m.mu.RUnlock()
+}
+
+// RLocker returns a Locker, which implements Lock and Unlock by calling
+// RLock and RUnlock of m. The acquisitions are recorded as reader locks.
+//  Returns:
+//   (sync.Locker): the reader locker of m
+func (m *RWMutex) RLocker() sync.Locker {
+	return (*rlocker)(m)
+}
+
+// type to implement the reader locker of a rw-mutex
+type rlocker RWMutex
+
+// R-Lock the rw-mutex of the reader locker
+//  Returns:
+//   nil
+func (r *rlocker) Lock() {
+	m := (*RWMutex)(r)
+	m.init()
+	// call the lock method for the mutexInt interface
+	lockInt(m, true)
+}
+
+// R-Unlock the rw-mutex of the reader locker
+//  Returns:
+//   nil
+func (r *rlocker) Unlock() {
+	m := (*RWMutex)(r)
+	m.init()
 	if opts.activated {
-		unlockInt(m)
+		unlockInt(m, true)
 	}
 	m.mu.RUnlock()
 }
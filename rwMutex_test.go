@@ -0,0 +1,159 @@
+package deadlock
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// hold m in another routine while f is executed
+func holdInOtherRoutine(m *RWMutex, rLock bool, f func()) {
+	held := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if rLock {
+			m.RLock()
+			defer m.RUnlock()
+		} else {
+			m.Lock()
+			defer m.Unlock()
+		}
+		close(held)
+		<-release
+	}()
+	<-held
+	f()
+	close(release)
+	wg.Wait()
+}
+
+func TestRWMutexTryLockWhileHeld(t *testing.T) {
+	tests := []struct {
+		name    string
+		holdR   bool
+		tryR    bool
+		success bool
+	}{
+		{"TryRLock while read-held", true, true, true},
+		{"TryRLock while write-held", false, true, false},
+		{"TryLock while read-held", true, false, false},
+		{"TryLock while write-held", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewRWLock()
+			holdInOtherRoutine(m, tt.holdR, func() {
+				var ok bool
+				if tt.tryR {
+					ok = m.TryRLock()
+				} else {
+					ok = m.TryLock()
+				}
+				if ok != tt.success {
+					t.Fatalf("got %v, want %v", ok, tt.success)
+				}
+				if !ok {
+					return
+				}
+				if tt.tryR {
+					m.RUnlock()
+				} else {
+					m.Unlock()
+				}
+			})
+		})
+	}
+}
+
+func TestRWMutexTryLockRecordsRLock(t *testing.T) {
+	tests := []struct {
+		name    string
+		lock    func(m *RWMutex) bool
+		unlock  func(m *RWMutex)
+		isRLock bool
+	}{
+		{"TryRLock", (*RWMutex).TryRLock, (*RWMutex).RUnlock, true},
+		{"RTryLock", (*RWMutex).RTryLock, (*RWMutex).RUnlock, true},
+		{"TryLock", (*RWMutex).TryLock, (*RWMutex).Unlock, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewRWLock()
+			// hold another lock, so that more than one routine is running
+			holdInOtherRoutine(NewRWLock(), false, func() {
+				if !tt.lock(m) {
+					t.Fatal("acquisition of an unlocked lock failed")
+				}
+				index := getRoutineIndex()
+				if index == -1 {
+					t.Fatal("routine is not tracked")
+				}
+				if got := m.getRLock(index); got != tt.isRLock {
+					t.Errorf("got rLock %v while held, want %v", got, tt.isRLock)
+				}
+				tt.unlock(m)
+			})
+		})
+	}
+}
+
+func TestRWMutexRecursiveTryRLock(t *testing.T) {
+	tests := []struct {
+		name  string
+		first func(m *RWMutex) bool
+		other bool
+	}{
+		{"TryRLock after RLock", func(m *RWMutex) bool { m.RLock(); return true }, false},
+		{"TryRLock after TryRLock", (*RWMutex).TryRLock, false},
+		{"TryRLock after RLock while read-held", func(m *RWMutex) bool { m.RLock(); return true }, true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := fmt.Sprintf("recursive-try-r-lock-%d", i)
+			m := NewRWLockNamed(name)
+			n := NewLock()
+
+			recursive := func() {
+				if !tt.first(m) {
+					t.Fatal("first acquisition failed")
+				}
+				n.Lock()
+				if !m.TryRLock() {
+					t.Fatal("recursive TryRLock failed")
+				}
+				n.Unlock()
+				m.RUnlock()
+				m.RUnlock()
+			}
+
+			if tt.other {
+				holdInOtherRoutine(m, true, recursive)
+			} else {
+				holdInOtherRoutine(NewRWLock(), false, recursive)
+			}
+
+			// a second routine uses the locks in the opposite order
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n.Lock()
+				if m.TryRLock() {
+					m.RUnlock()
+				}
+				n.Unlock()
+			}()
+			wg.Wait()
+
+			if reports := reportsOfLock(t, name); len(reports) != 0 {
+				t.Errorf("got reports %v, want none", reports)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package deadlock
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// The stress test is meant to be run with the race detector:
+//  go test -race -run Stress
+// It uses the locks, condition variables, wait groups and channels from many
+// routines, while the detectors, the watchdog, the online lock-order graph,
+// the reclamation of terminated routines and the setters of the locks run
+// concurrently.
+func TestStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test is skipped in short mode")
+	}
+
+	const workers = 8
+	const iterations = 300
+
+	// the locks are always acquired in the order a, b, rw, named
+	a := NewLockNamed("stress-a")
+	b := NewLockNamed("stress-b")
+	rw := NewRWLockNamed("stress-rw")
+	named := NewLock()
+
+	// each routine waiting for cond waits for its own flag, which is set
+	// before the broadcast
+	condLock := NewLockNamed("stress-cond-lock")
+	cond := NewCond(condLock)
+	flags := make(map[int]bool)
+
+	// each value sent on ch is received by one of the workers
+	ch := NewChan[int](0)
+
+	var workersDone sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersDone.Add(1)
+		go func(i int) {
+			defer workersDone.Done()
+			for j := 0; j < iterations; j++ {
+				switch (i + j) % 9 {
+				case 0:
+					a.Lock()
+					b.Lock()
+					b.Unlock()
+					a.Unlock()
+				case 1:
+					a.Lock()
+					rw.RLock()
+					rw.RUnlock()
+					a.Unlock()
+				case 2:
+					b.Lock()
+					if rw.TryLock() {
+						rw.Unlock()
+					}
+					b.Unlock()
+				case 3:
+					if rw.TryRLock() {
+						named.Lock()
+						named.Unlock()
+						rw.RUnlock()
+					}
+				case 4:
+					named.SetName(fmt.Sprintf("stress-named-%d", j))
+					named.SetClass(fmt.Sprintf("stress-class-%d", i))
+					named.Lock()
+					named.Unlock()
+				case 5:
+					// short-lived routines fill the slots, which must be reclaimed
+					done := make(chan struct{})
+					go func() {
+						defer close(done)
+						b.Lock()
+						b.Unlock()
+					}()
+					<-done
+				case 6:
+					flag := i*iterations + j
+					go func() {
+						condLock.Lock()
+						flags[flag] = true
+						cond.Signal()
+						cond.Broadcast()
+						condLock.Unlock()
+					}()
+					condLock.Lock()
+					for !flags[flag] {
+						cond.Wait()
+					}
+					delete(flags, flag)
+					condLock.Unlock()
+				case 7:
+					var wg WaitGroup
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						a.Lock()
+						a.Unlock()
+					}()
+					wg.Go(func() {
+						b.Lock()
+						rw.RLock()
+						rw.RUnlock()
+						b.Unlock()
+					})
+					wg.Wait()
+				case 8:
+					go ch.Send(j)
+					ch.Recv()
+				}
+			}
+		}(i)
+	}
+
+	// run the detectors and the reclamation until the workers are done
+	stop := make(chan struct{})
+	var detectorsDone sync.WaitGroup
+	for _, detector := range []func(){
+		func() { periodicalDetection(newPeriodicalState()) },
+		reclaimRoutines,
+		func() { GetPotentialDeadlocks() },
+		func() { WriteLockGraph(io.Discard) },
+		checkWatchdog,
+	} {
+		detectorsDone.Add(1)
+		go func(detector func()) {
+			defer detectorsDone.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					detector()
+					// the detectors run much more often than in a program, the
+					// workers must still be able to make progress
+					runtime.Gosched()
+				}
+			}
+		}(detector)
+	}
+
+	workersDone.Wait()
+	close(stop)
+	detectorsDone.Wait()
+
+	for _, name := range []string{"stress-a", "stress-b", "stress-rw", "stress-cond-lock"} {
+		if reports := reportsOfLock(t, name); len(reports) != 0 {
+			t.Errorf("got reports %v for lock %s, want none", reports, name)
+		}
+	}
+}
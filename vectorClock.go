@@ -0,0 +1,203 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+vectorClock.go
+This file implements vector clocks for the routines, which are used to
+discard potential deadlocks whose dependencies can not happen concurrently.
+A routine inherits the clock of its parent, if it is started with Go, and the
+parent receives the clock of the routine, when it joins it. Dependencies,
+which are ordered by the start or join of a routine, can therefore not be part
+of the same deadlock.
+*/
+
+// vector clock, maps the internal id of a routine to its logical time.
+// Vector clocks are never changed after they were created, so that they can
+// be shared by the routine and its dependencies.
+type vectorClock map[int64]uint64
+
+// create the initial vector clock of a routine
+//  Args:
+//   id (int64): internal id of the routine
+//  Returns:
+//   (vectorClock): the created vector clock
+func newVectorClock(id int64) vectorClock {
+	return vectorClock{id: 1}
+}
+
+// get a copy of vc, in which the time of routine id is incremented
+//  Args:
+//   id (int64): internal id of the routine
+//  Returns:
+//   (vectorClock): the incremented vector clock
+func (vc vectorClock) increment(id int64) vectorClock {
+	res := make(vectorClock, len(vc))
+	for i, t := range vc {
+		res[i] = t
+	}
+	res[id]++
+	return res
+}
+
+// get the element-wise maximum of vc and other
+//  Args:
+//   other (vectorClock): vector clock to merge with vc
+//  Returns:
+//   (vectorClock): the merged vector clock
+func (vc vectorClock) merge(other vectorClock) vectorClock {
+	res := make(vectorClock, len(vc))
+	for i, t := range vc {
+		res[i] = t
+	}
+	for i, t := range other {
+		if t > res[i] {
+			res[i] = t
+		}
+	}
+	return res
+}
+
+// check if all occurrences of dependency a happen before all occurrences of
+// dependency b. This is the case, if the clock of the last occurrence of a is
+// smaller or equal to the clock of the first occurrence of b for the routine
+// of a
+//  Args:
+//   a (*dependency): first dependency
+//   b (*dependency): second dependency
+//  Returns:
+//   (bool): true if a happens before b, false otherwise
+func happensBefore(a, b *dependency) bool {
+	if a.lastVC == nil || b.firstVC == nil {
+		return false
+	}
+	return a.lastVC[a.id] <= b.firstVC[a.id]
+}
+
+// check if two dependencies can happen concurrently
+//  Args:
+//   a (*dependency): first dependency
+//   b (*dependency): second dependency
+//  Returns:
+//   (bool): true if neither a happens before b nor b happens before a
+func isConcurrent(a, b *dependency) bool {
+	return !happensBefore(a, b) && !happensBefore(b, a)
+}
+
+// get the current vector clock of r
+//  Returns:
+//   (vectorClock): the vector clock
+func (r *routine) getClock() vectorClock {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.vc
+}
+
+// get the current vector clock of r to pass it to another routine and
+// increment the clock of r, so that later operations of r do not happen
+// before the other routine
+//  Returns:
+//   (vectorClock): the vector clock before the increment
+func (r *routine) sendClock() vectorClock {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	vc := r.vc
+	r.vc = r.vc.increment(r.id)
+	return vc
+}
+
+// merge the vector clock vc received from another routine into the clock of r
+//  Args:
+//   vc (vectorClock): received vector clock
+//  Returns:
+//   nil
+func (r *routine) receiveClock(vc vectorClock) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.vc = r.vc.merge(vc).increment(r.id)
+}
+
+// Goroutine is the handle of a routine started with Go
+type Goroutine struct {
+	// closed when the function of the routine has returned
+	done chan struct{}
+	// vector clock of the routine when its function returned
+	vc vectorClock
+}
+
+// Go starts f in a new routine. The detector knows that everything the
+// calling routine did before Go happens before f, so that potential deadlocks
+// between them are not reported.
+//  Args:
+//   f (func()): function to run in the new routine
+//  Returns:
+//   (*Goroutine): handle of the new routine, which can be used to join it
+func Go(f func()) *Goroutine {
+	g := &Goroutine{done: make(chan struct{})}
+
+	// the new routine inherits the clock of the calling routine
+	var vc vectorClock
+	if r := getResourceRoutine(); r != nil {
+		vc = r.sendClock()
+	}
+
+	go func() {
+		// save the final clock of the routine for Join
+		defer func() {
+			// the routine must not terminate while holding locks
+			reportLockLeakOnExit()
+
+			if index := getRoutineIndex(); index != -1 {
+				g.vc = getRoutine(index).getClock()
+			}
+			close(g.done)
+		}()
+
+		if vc != nil {
+			if r := getResourceRoutine(); r != nil {
+				r.receiveClock(vc)
+			}
+		}
+
+		f()
+	}()
+
+	return g
+}
+
+// Join waits until the function of the routine g has returned. The detector
+// knows that everything g did happens before everything the calling routine
+// does after Join.
+//  Returns:
+//   nil
+func (g *Goroutine) Join() {
+	<-g.done
+
+	if r := getResourceRoutine(); r != nil {
+		r.receiveClock(g.vc)
+	}
+}
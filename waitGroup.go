@@ -0,0 +1,191 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+waitGroup.go
+This file implements the drop-in-replacement for sync.WaitGroup. Waiting for
+the wait group is recorded as resource dependency. Each lock acquired by a
+worker before it calls Done is recorded as acquired while holding the wait
+group, because Wait can only return after the lock was acquired. This way the
+detector finds a routine which waits for the wait group while holding a lock
+the workers need. Only routines started with Go are known as workers while
+they run, therefore the periodical detection can only confirm actual
+deadlocks with these routines.
+*/
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Type to implement a wait group
+// It can be used as a drop in replacement for sync.WaitGroup. Routines
+// started with Go are known as workers of the wait group while they run, so
+// that the periodical detection can find actual deadlocks between them and
+// the waiting routine. Routines which only use Add and Done are not known
+// as workers, because the routine which calls Done is not known before, so
+// that only the comprehensive detection considers them.
+type WaitGroup struct {
+	// wait group for the actual waiting
+	wg sync.WaitGroup
+	// resource which represents the wait group in the lock trees
+	res *resource
+	// set to 1 after the wait group was initialized
+	in uint32
+	// lock to prevent multiple concurrent initializations
+	inLock sync.Mutex
+	// merged vector clocks of the routines at their calls of Done
+	vc vectorClock
+	// lock to prevent concurrent access to vc
+	vcLock sync.Mutex
+}
+
+// init initializes the wait group if it has not been initialized yet.
+// The position of the caller of the function that called init is saved as
+// the creation of the wait group.
+//  Returns:
+//   nil
+func (wg *WaitGroup) init() {
+	// fast path if the wait group is already initialized
+	if atomic.LoadUint32(&wg.in) == 1 {
+		return
+	}
+
+	wg.inLock.Lock()
+	defer wg.inLock.Unlock()
+
+	// another routine may have initialized the wait group in the meantime
+	if wg.in == 1 {
+		return
+	}
+
+	// initialize detector if necessary
+	initialize()
+	atomic.StoreUint32(&acquiredLocksUsed, 1)
+
+	// save the position of the first call
+	_, file, line, _ := runtime.Caller(2)
+	wg.res = newResource("waitgroup", file, line)
+
+	atomic.StoreUint32(&wg.in, 1)
+}
+
+// Add adds delta, which may be negative, to the counter of the wait group.
+// Add does not make the calling routine a worker of the wait group, only
+// routines started with Go are known as workers.
+//  Args:
+//   delta (int): value to add to the counter
+//  Returns:
+//   nil
+func (wg *WaitGroup) Add(delta int) {
+	wg.init()
+	wg.wg.Add(delta)
+}
+
+// Done decrements the counter of the wait group by one. The locks which the
+// calling routine acquired since its last call of Done are recorded as
+// acquired while holding the wait group.
+//  Returns:
+//   nil
+func (wg *WaitGroup) Done() {
+	wg.init()
+
+	// the locks acquired by a worker started with Go already depend on the
+	// wait group
+	if !releaseResource(wg.res) {
+		releaseAcquiredResource(wg.res)
+	}
+
+	wg.sendClock()
+	wg.wg.Done()
+}
+
+// Go calls f in a new routine and adds it to the wait group. While f runs,
+// the routine is known as worker of the wait group.
+//  Args:
+//   f (func()): function to run in the new routine
+//  Returns:
+//   nil
+func (wg *WaitGroup) Go(f func()) {
+	wg.init()
+	wg.wg.Add(1)
+	Go(func() {
+		defer func() {
+			releaseResource(wg.res)
+			wg.sendClock()
+			wg.wg.Done()
+		}()
+
+		// the worker holds the wait group until it is done
+		holdResource(wg.res)
+		f()
+	})
+}
+
+// Wait blocks until the counter of the wait group is zero. Waiting while
+// holding locks is added to the lock trees.
+//  Returns:
+//   nil
+func (wg *WaitGroup) Wait() {
+	wg.init()
+
+	// the routine waits for the workers while holding its locks
+	waitResource(wg.res)
+
+	r := getResourceRoutine()
+	if r != nil {
+		r.startWaiting(wg.res, false, false)
+	}
+
+	wg.wg.Wait()
+
+	if r != nil {
+		r.stopWaiting()
+
+		// everything the workers did before Done happens before the return
+		// of Wait
+		wg.vcLock.Lock()
+		vc := wg.vc
+		wg.vcLock.Unlock()
+		r.receiveClock(vc)
+	}
+}
+
+// pass the vector clock of the current routine to the routines waiting for
+// the wait group
+//  Returns:
+//   nil
+func (wg *WaitGroup) sendClock() {
+	r := getResourceRoutine()
+	if r == nil {
+		return
+	}
+
+	vc := r.sendClock()
+	wg.vcLock.Lock()
+	wg.vc = wg.vc.merge(vc)
+	wg.vcLock.Unlock()
+}
@@ -0,0 +1,39 @@
+package deadlock
+
+import (
+	"testing"
+)
+
+func TestWaitGroupGoWorkersLockInversion(t *testing.T) {
+	// free the slots of the routines of earlier tests, so that the workers
+	// are tracked
+	reclaimRoutines()
+
+	a := NewLockNamed("wait-group-go-a")
+	b := NewLockNamed("wait-group-go-b")
+
+	// the second worker only starts after the first one released the locks,
+	// so the program does not deadlock, but the workers run concurrently
+	// according to the vector clocks
+	firstDone := make(chan struct{})
+	var wg WaitGroup
+	wg.Go(func() {
+		a.Lock()
+		b.Lock()
+		b.Unlock()
+		a.Unlock()
+		close(firstDone)
+	})
+	wg.Go(func() {
+		<-firstDone
+		b.Lock()
+		a.Lock()
+		a.Unlock()
+		b.Unlock()
+	})
+	wg.Wait()
+
+	if reports := reportsOfLock(t, "wait-group-go-a"); len(reports) == 0 {
+		t.Error("got no report for the lock inversion of the workers")
+	}
+}
@@ -0,0 +1,281 @@
+package deadlock
+
+/*
+Copyright (c) 2022, Erik Kassubek
+All rights reserved.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Author: Erik Kassubek <erik-kassubek@t-online.de>
+Package: deadlock
+Project: Bachelor Project at the Albert-Ludwigs-University Freiburg,
+	Institute of Computer Science: Dynamic Deadlock Detection in Go
+*/
+
+/*
+watchdog.go
+This file implements the watchdog for the hold and wait times of locks. For
+each lock acquisition, the time when it started waiting and the time when the
+lock was granted are recorded. The watchdog periodically checks these records
+and reports acquisitions which wait or hold a lock longer than the thresholds
+set in the options, together with the current call stacks of the involved
+routines.
+*/
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/petermattis/goid"
+)
+
+// record of a lock acquisition
+type acquisition struct {
+	// acquired lock
+	m mutexInt
+	// true if the lock is acquired as reader lock
+	rLock bool
+	// internal id of the acquiring routine
+	id int64
+	// position of the lock call
+	file string
+	line int
+	// time when the acquisition started waiting
+	waitStart time.Time
+	// time when the lock was granted, zero while the acquisition is waiting
+	granted time.Time
+	// true if the wait or hold time has already been reported
+	reportedWait bool
+	reportedHold bool
+}
+
+// key of the acquisitions of a lock by a routine
+type acquisitionKey struct {
+	// memory position of the lock
+	lock uintptr
+	// internal id of the routine
+	id int64
+}
+
+// records of the current acquisitions. A routine can hold a reader lock
+// multiple times, therefore each key can have multiple records
+var acquisitions = make(map[acquisitionKey][]*acquisition)
+
+// lock to prevent concurrent access to acquisitions
+var acquisitionsLock sync.Mutex
+
+// check if the watchdog is enabled
+//  Returns:
+//   (bool): true if a hold or wait time threshold is set
+func watchdogEnabled() bool {
+	return opts.holdTimeThreshold > 0 || opts.waitTimeThreshold > 0
+}
+
+// record that the current routine starts to wait for m
+//  Args:
+//   m (mutexInt): lock which is acquired
+//   rLock (bool): true if m is acquired as reader lock
+//  Returns:
+//   (*acquisition): the record of the acquisition, nil if the watchdog is
+//    disabled
+func watchdogWait(m mutexInt, rLock bool) *acquisition {
+	if !watchdogEnabled() {
+		return nil
+	}
+
+	// get the position of the lock call
+	_, file, line, _ := runtime.Caller(3)
+
+	a := &acquisition{
+		m:         m,
+		rLock:     rLock,
+		id:        goid.Get(),
+		file:      file,
+		line:      line,
+		waitStart: time.Now(),
+	}
+
+	key := acquisitionKey{lock: m.getMemoryPosition(), id: a.id}
+	acquisitionsLock.Lock()
+	acquisitions[key] = append(acquisitions[key], a)
+	acquisitionsLock.Unlock()
+
+	return a
+}
+
+// record that the lock of a was granted
+//  Args:
+//   a (*acquisition): record of the acquisition, may be nil
+//  Returns:
+//   nil
+func watchdogGranted(a *acquisition) {
+	if a == nil {
+		return
+	}
+
+	acquisitionsLock.Lock()
+	a.granted = time.Now()
+	acquisitionsLock.Unlock()
+}
+
+// remove the record of a canceled acquisition
+//  Args:
+//   a (*acquisition): record of the acquisition, may be nil
+//  Returns:
+//   nil
+func watchdogCancel(a *acquisition) {
+	if a == nil {
+		return
+	}
+
+	acquisitionsLock.Lock()
+	removeAcquisition(acquisitionKey{lock: a.m.getMemoryPosition(), id: a.id}, a)
+	acquisitionsLock.Unlock()
+}
+
+// remove the record of the acquisition of m, which is released. If m is
+// released by another routine than the one which acquired it, the record of
+// any routine holding m is removed.
+//  Args:
+//   m (mutexInt): lock which is released
+//  Returns:
+//   nil
+func watchdogRelease(m mutexInt) {
+	if !watchdogEnabled() {
+		return
+	}
+
+	acquisitionsLock.Lock()
+	defer acquisitionsLock.Unlock()
+
+	// remove the last granted acquisition of m by the current routine
+	key := acquisitionKey{lock: m.getMemoryPosition(), id: goid.Get()}
+	if a := lastGrantedAcquisition(acquisitions[key]); a != nil {
+		removeAcquisition(key, a)
+		return
+	}
+
+	// m was acquired by another routine
+	for key, list := range acquisitions {
+		if key.lock != m.getMemoryPosition() {
+			continue
+		}
+		if a := lastGrantedAcquisition(list); a != nil {
+			removeAcquisition(key, a)
+			return
+		}
+	}
+}
+
+// get the last granted acquisition in list
+//  Args:
+//   list ([]*acquisition): list of acquisitions
+//  Returns:
+//   (*acquisition): the last granted acquisition, nil if there is none
+func lastGrantedAcquisition(list []*acquisition) *acquisition {
+	for i := len(list) - 1; i >= 0; i-- {
+		if !list[i].granted.IsZero() {
+			return list[i]
+		}
+	}
+	return nil
+}
+
+// remove the record a from the acquisitions with the given key.
+// acquisitionsLock must be held by the caller.
+//  Args:
+//   key (acquisitionKey): key of the acquisition
+//   a (*acquisition): record to remove
+//  Returns:
+//   nil
+func removeAcquisition(key acquisitionKey, a *acquisition) {
+	list := acquisitions[key]
+	for i, b := range list {
+		if b == a {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+
+	if len(list) == 0 {
+		delete(acquisitions, key)
+	} else {
+		acquisitions[key] = list
+	}
+}
+
+// check the hold and wait times of all current acquisitions and report the
+// acquisitions which exceed the thresholds. Each acquisition is reported at
+// most once for waiting and once for holding.
+//  Returns:
+//   nil
+func checkWatchdog() {
+	now := time.Now()
+
+	// the acquisitions are copied, because the granted time is changed by the
+	// routines after acquisitionsLock is released
+	var longWaits, longHolds []acquisition
+
+	acquisitionsLock.Lock()
+	for _, list := range acquisitions {
+		for _, a := range list {
+			if a.granted.IsZero() {
+				if opts.waitTimeThreshold > 0 && !a.reportedWait &&
+					now.Sub(a.waitStart) > opts.waitTimeThreshold {
+					a.reportedWait = true
+					longWaits = append(longWaits, *a)
+				}
+			} else if opts.holdTimeThreshold > 0 && !a.reportedHold &&
+				now.Sub(a.granted) > opts.holdTimeThreshold {
+				a.reportedHold = true
+				longHolds = append(longHolds, *a)
+			}
+		}
+	}
+
+	// get the current holders of the locks with long waits
+	holders := make([][]acquisition, len(longWaits))
+	for i, a := range longWaits {
+		for key, list := range acquisitions {
+			if key.lock != a.m.getMemoryPosition() {
+				continue
+			}
+			for _, b := range list {
+				if !b.granted.IsZero() {
+					holders[i] = append(holders[i], *b)
+				}
+			}
+		}
+	}
+	acquisitionsLock.Unlock()
+
+	if len(longWaits) == 0 && len(longHolds) == 0 {
+		return
+	}
+
+	// get the current call stacks of all routines
+	stacks := getRoutineStacks()
+
+	var reports []Report
+	for i := range longWaits {
+		reports = append(reports,
+			newReportLongWait(&longWaits[i], holders[i], now, stacks))
+	}
+	for i := range longHolds {
+		reports = append(reports, newReportLongHold(&longHolds[i], now, stacks))
+	}
+
+	printReports(reports)
+}